@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+var (
+	algo     = flag.String("algo", pluginutil.HashAlgoBcrypt, "hash algorithm: bcrypt|argon2id|pbkdf2-sha256|sha256|legacy|scram-sha-256")
+	salt     = flag.String("salt", "", "salt (legacy only; other algorithms generate a random salt)")
+	password = flag.String("password", "", "password")
+)
+
+func main() {
+	flag.Parse()
+
+	if *password == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// legacy 与认证插件历史格式一致：password+salt 后做 SHA-256 十六进制输出，盐需另存 salt 字段。
+	if *algo == pluginutil.HashAlgoLegacy {
+		fmt.Println(pluginutil.SHA256PwdSalt(*password, *salt))
+		return
+	}
+	// scram-sha-256 输出写入 scram_verifier 列的验证器，供 MQTT v5 增强认证使用。
+	if strings.EqualFold(*algo, pluginutil.SCRAMSHA256) {
+		verifier, err := pluginutil.NewSCRAMVerifier(*password, pluginutil.SCRAMDefaultIterations)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(verifier)
+		return
+	}
+	name, ok := pluginutil.ParseHashAlgorithm(*algo)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unsupported algorithm: %s\n", *algo)
+		os.Exit(2)
+	}
+	encoded, err := pluginutil.HashPassword(name, *password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(encoded)
+}
@@ -0,0 +1,117 @@
+package pluginutil
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// BreakerState 为熔断器状态。
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// ErrBreakerOpen 表示熔断器处于打开状态，请求未访问数据库即失败。
+var ErrBreakerOpen = errors.New("postgres circuit breaker open")
+
+// CircuitBreaker 在连续失败 threshold 次后打开，openFor 内直接拒绝请求；
+// 到期后进入半开状态只放行一个探测请求，探测成功则关闭，失败则重新打开。线程安全。
+type CircuitBreaker struct {
+	threshold int
+	openFor   time.Duration
+	onChange  func(from, to BreakerState)
+	// now 便于测试注入时钟。
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	// probeAt 为半开状态放行探测请求的时刻。
+	probeAt time.Time
+}
+
+// NewCircuitBreaker 创建熔断器；onChange 在状态变化时调用（不持锁），可为 nil。
+func NewCircuitBreaker(threshold int, openFor time.Duration, onChange func(from, to BreakerState)) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{threshold: threshold, openFor: openFor, onChange: onChange, now: time.Now}
+}
+
+// Allow 判断本次请求能否访问数据库；打开期间返回 ErrBreakerOpen。
+// 半开状态下探测请求超过 openFor 仍未回报结果时，再放行一个，避免探测方未调用 Record 而一直卡住。
+func (b *CircuitBreaker) Allow() error {
+	now := b.now()
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case BreakerClosed:
+		b.mu.Unlock()
+		return nil
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.openFor {
+			b.mu.Unlock()
+			return ErrBreakerOpen
+		}
+		b.state = BreakerHalfOpen
+	default:
+		if now.Sub(b.probeAt) < b.openFor {
+			b.mu.Unlock()
+			return ErrBreakerOpen
+		}
+	}
+	b.probeAt = now
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+	return nil
+}
+
+// Record 回报一次请求结果；failed 只应包含连接层错误，SQL 错误说明数据库可达，按成功处理。
+func (b *CircuitBreaker) Record(failed bool) {
+	now := b.now()
+	b.mu.Lock()
+	from := b.state
+	if !failed {
+		b.failures = 0
+		b.state = BreakerClosed
+	} else {
+		b.failures++
+		if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+			b.state = BreakerOpen
+			b.openedAt = now
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+// State 返回当前状态。
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *CircuitBreaker) notify(from, to BreakerState) {
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
@@ -0,0 +1,159 @@
+package pluginutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func newTestBreaker(threshold int, openFor time.Duration) (*CircuitBreaker, *time.Time, *[]string) {
+	now := time.Unix(1700000000, 0)
+	var changes []string
+	b := NewCircuitBreaker(threshold, openFor, func(from, to BreakerState) {
+		changes = append(changes, from.String()+"->"+to.String())
+	})
+	b.now = func() time.Time { return now }
+	return b, &now, &changes
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b, _, changes := newTestBreaker(3, time.Second)
+	b.Record(true)
+	b.Record(true)
+	if b.State() != BreakerClosed || b.Allow() != nil {
+		t.Fatalf("breaker should stay closed below threshold")
+	}
+	// 成功复位计数，需要重新累计连续错误。
+	b.Record(false)
+	b.Record(true)
+	b.Record(true)
+	if b.State() != BreakerClosed {
+		t.Fatalf("success should reset failure count")
+	}
+	b.Record(true)
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s, want open", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("Allow() = %v, want ErrBreakerOpen", err)
+	}
+	if len(*changes) != 1 || (*changes)[0] != "closed->open" {
+		t.Fatalf("changes = %v", *changes)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	b, now, changes := newTestBreaker(1, time.Second)
+	b.Record(true)
+
+	*now = now.Add(time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe should be allowed after openFor: %v", err)
+	}
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("state = %s, want half_open", b.State())
+	}
+	// 探测未回报结果前只放行一个请求。
+	if err := b.Allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("second request during probe = %v, want ErrBreakerOpen", err)
+	}
+
+	// 探测失败立即重新打开，重新计时。
+	b.Record(true)
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s, want open after failed probe", b.State())
+	}
+	*now = now.Add(500 * time.Millisecond)
+	if err := b.Allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("Allow() = %v, want ErrBreakerOpen", err)
+	}
+
+	*now = now.Add(500 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe should be allowed: %v", err)
+	}
+	b.Record(false)
+	if b.State() != BreakerClosed || b.Allow() != nil {
+		t.Fatalf("successful probe should close breaker")
+	}
+	want := []string{"closed->open", "open->half_open", "half_open->open", "open->half_open", "half_open->closed"}
+	if len(*changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", *changes, want)
+	}
+	for i := range want {
+		if (*changes)[i] != want[i] {
+			t.Fatalf("changes = %v, want %v", *changes, want)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeTimeout(t *testing.T) {
+	b, now, _ := newTestBreaker(1, time.Second)
+	b.Record(true)
+	*now = now.Add(time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe should be allowed: %v", err)
+	}
+	// 探测方一直没有回报时，openFor 后再放行一个探测请求。
+	*now = now.Add(time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("stalled probe should be replaced: %v", err)
+	}
+}
+
+func TestPGClusterBreakerFailsFast(t *testing.T) {
+	var c PGCluster
+	c.Configure([]string{"postgres://127.0.0.1:1/none?connect_timeout=1"}, PGPoolOptions{}, nil)
+	defer c.Close()
+	c.SetBreakers(1, time.Hour, nil)
+	b := c.nodes[0].breaker
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := c.Ensure(ctx, PGPrimary); err == nil || errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("first Ensure should try the database, got %v", err)
+	}
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s, want open", b.State())
+	}
+	start := time.Now()
+	if _, err := c.Ensure(ctx, PGPrimary); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("Ensure() = %v, want ErrBreakerOpen", err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Fatalf("Ensure took %s while breaker open", d)
+	}
+}
+
+func TestPGClusterBreakerPerNode(t *testing.T) {
+	var c PGCluster
+	var opened []string
+	c.Configure([]string{"primary", "replica"}, PGPoolOptions{}, nil)
+	c.SetBreakers(1, time.Hour, func(dsn string, from, to BreakerState) {
+		if to == BreakerOpen {
+			opened = append(opened, dsn)
+		}
+	})
+	primary, replica := &pgxpool.Pool{}, &pgxpool.Pool{}
+	c.mu.Lock()
+	c.nodes[0].pool, c.nodes[0].healthy = primary, true
+	c.nodes[1].pool, c.nodes[1].healthy, c.nodes[1].inRecovery = replica, true, true
+	c.reselectLocked()
+	c.mu.Unlock()
+
+	c.Report(primary, io.EOF)
+	if !reflect.DeepEqual(opened, []string{"primary"}) {
+		t.Fatalf("opened = %v, want only primary", opened)
+	}
+	if c.nodes[1].breaker.State() != BreakerClosed {
+		t.Fatalf("replica breaker = %s, want closed", c.nodes[1].breaker.State())
+	}
+	if p, err := c.Ensure(context.Background(), PGReplica); err != nil || p != replica {
+		t.Fatalf("Ensure(replica) = %p, %v; want healthy replica", p, err)
+	}
+}
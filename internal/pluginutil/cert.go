@@ -0,0 +1,74 @@
+package pluginutil
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+)
+
+// 证书身份来源，用于 CertIdentity。
+const (
+	CertIdentityCN       = "cn"
+	CertIdentitySANDNS   = "san_dns"
+	CertIdentitySANEmail = "san_email"
+	CertIdentitySANURI   = "san_uri"
+)
+
+// ParseCertIdentitySources 解析逗号分隔的身份来源列表，按顺序取第一个非空值。
+func ParseCertIdentitySources(v string) ([]string, bool) {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		s := strings.ToLower(strings.TrimSpace(item))
+		switch s {
+		case "":
+			continue
+		case CertIdentityCN, CertIdentitySANDNS, CertIdentitySANEmail, CertIdentitySANURI:
+			out = append(out, s)
+		default:
+			return nil, false
+		}
+	}
+	return out, len(out) > 0
+}
+
+// CertIdentity 按来源顺序返回证书中的第一个身份；SAN 存在多个值时取第一个。
+func CertIdentity(cert *x509.Certificate, sources []string) string {
+	if cert == nil {
+		return ""
+	}
+	for _, s := range sources {
+		switch s {
+		case CertIdentityCN:
+			if cert.Subject.CommonName != "" {
+				return cert.Subject.CommonName
+			}
+		case CertIdentitySANDNS:
+			if len(cert.DNSNames) > 0 {
+				return cert.DNSNames[0]
+			}
+		case CertIdentitySANEmail:
+			if len(cert.EmailAddresses) > 0 {
+				return cert.EmailAddresses[0]
+			}
+		case CertIdentitySANURI:
+			if len(cert.URIs) > 0 {
+				return cert.URIs[0].String()
+			}
+		}
+	}
+	return ""
+}
+
+// CertFingerprint 返回证书 DER 的 SHA-256 指纹（小写十六进制，无分隔符）。
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint 统一指纹写法：去掉 "sha256:" 前缀、冒号与空白并转小写。
+func NormalizeFingerprint(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "sha256:")
+	return strings.NewReplacer(":", "", " ", "").Replace(s)
+}
@@ -0,0 +1,91 @@
+package pluginutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCertificate(t *testing.T, tmpl *x509.Certificate) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(1)
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertIdentity(t *testing.T) {
+	u, _ := url.Parse("spiffe://plant/gw-7")
+	cert := testCertificate(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "gw-7"},
+		DNSNames:       []string{"gw-7.plant.local"},
+		EmailAddresses: []string{"gw-7@plant.local"},
+		URIs:           []*url.URL{u},
+	})
+	cases := map[string]string{
+		"cn":             "gw-7",
+		"san_dns":        "gw-7.plant.local",
+		"san_email":      "gw-7@plant.local",
+		"san_uri":        "spiffe://plant/gw-7",
+		"san_dns, cn":    "gw-7.plant.local",
+		" SAN_URI , cn ": "spiffe://plant/gw-7",
+	}
+	for in, want := range cases {
+		sources, ok := ParseCertIdentitySources(in)
+		if !ok {
+			t.Fatalf("ParseCertIdentitySources(%q) failed", in)
+		}
+		if got := CertIdentity(cert, sources); got != want {
+			t.Errorf("CertIdentity(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	noCN := testCertificate(t, &x509.Certificate{DNSNames: []string{"only-dns"}})
+	if got := CertIdentity(noCN, []string{CertIdentityCN, CertIdentitySANDNS}); got != "only-dns" {
+		t.Errorf("fallback identity = %q", got)
+	}
+	if got := CertIdentity(noCN, []string{CertIdentityCN}); got != "" {
+		t.Errorf("missing cn identity = %q", got)
+	}
+	for _, bad := range []string{"", "subject", "cn,ou"} {
+		if _, ok := ParseCertIdentitySources(bad); ok {
+			t.Errorf("ParseCertIdentitySources(%q) should fail", bad)
+		}
+	}
+}
+
+func TestCertFingerprint(t *testing.T) {
+	cert := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "gw"}})
+	fp := CertFingerprint(cert)
+	if len(fp) != 64 || strings.ToLower(fp) != fp {
+		t.Fatalf("fingerprint = %q", fp)
+	}
+	var colon []string
+	for i := 0; i < len(fp); i += 2 {
+		colon = append(colon, strings.ToUpper(fp[i:i+2]))
+	}
+	for _, in := range []string{fp, "SHA256:" + strings.ToUpper(fp), strings.Join(colon, ":"), " " + fp + " "} {
+		if got := NormalizeFingerprint(in); got != fp {
+			t.Errorf("NormalizeFingerprint(%q) = %q", in, got)
+		}
+	}
+}
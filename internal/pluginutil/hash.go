@@ -0,0 +1,214 @@
+package pluginutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// 密码哈希算法标识；除 HashAlgoLegacy 外都以 "$<algo>$" 前缀自描述。
+const (
+	HashAlgoBcrypt       = "bcrypt"
+	HashAlgoArgon2id     = "argon2id"
+	HashAlgoPBKDF2SHA256 = "pbkdf2-sha256"
+	HashAlgoSHA256       = "sha256"
+	// HashAlgoLegacy 表示无前缀的历史格式：hex(sha256(password + salt))，盐来自独立字段。
+	HashAlgoLegacy = "legacy"
+)
+
+// 新生成哈希使用的默认参数（参考 OWASP 密码存储建议）。
+const (
+	bcryptCost       = bcrypt.DefaultCost
+	argon2Time       = 2
+	argon2MemoryKiB  = 19 * 1024
+	argon2Threads    = 1
+	argon2KeyLen     = 32
+	pbkdf2Iterations = 600000
+	pbkdf2KeyLen     = 32
+	hashSaltLen      = 16
+)
+
+// ErrUnsupportedHash 表示哈希前缀未知或格式无法解析。
+var ErrUnsupportedHash = errors.New("unsupported password hash")
+
+// HashAlgorithm 根据前缀识别哈希算法；无法识别的 "$" 前缀返回空字符串。
+func HashAlgorithm(encoded string) string {
+	switch {
+	case !strings.HasPrefix(encoded, "$"):
+		return HashAlgoLegacy
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return HashAlgoBcrypt
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return HashAlgoArgon2id
+	case strings.HasPrefix(encoded, "$pbkdf2-sha256$"):
+		return HashAlgoPBKDF2SHA256
+	case strings.HasPrefix(encoded, "$sha256$"):
+		return HashAlgoSHA256
+	default:
+		return ""
+	}
+}
+
+// ParseHashAlgorithm 校验配置中的算法名称。
+func ParseHashAlgorithm(v string) (string, bool) {
+	switch algo := strings.ToLower(strings.TrimSpace(v)); algo {
+	case HashAlgoBcrypt, HashAlgoArgon2id, HashAlgoPBKDF2SHA256, HashAlgoSHA256:
+		return algo, true
+	default:
+		return "", false
+	}
+}
+
+// SHA256PwdSalt 使用盐对密码做 SHA-256，并返回十六进制字符串（历史格式）。
+func SHA256PwdSalt(password, salt string) string {
+	sum := sha256.Sum256([]byte(password + salt))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyPassword 按前缀分派校验；salt 仅用于无前缀的历史格式。
+// 格式错误返回 ErrUnsupportedHash，调用方应按拒绝处理而非数据库错误。
+func VerifyPassword(password, encoded, salt string) (bool, error) {
+	switch HashAlgorithm(encoded) {
+	case HashAlgoLegacy:
+		return constantTimeEqual(SHA256PwdSalt(password, salt), encoded), nil
+	case HashAlgoBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", ErrUnsupportedHash, err)
+		}
+		return true, nil
+	case HashAlgoArgon2id:
+		return verifyArgon2id(password, encoded)
+	case HashAlgoPBKDF2SHA256:
+		return verifyPBKDF2SHA256(password, encoded)
+	case HashAlgoSHA256:
+		// $sha256$<salt>$<hex>：盐可能包含 '$'，以最后一个分隔符切分。
+		rest := strings.TrimPrefix(encoded, "$sha256$")
+		i := strings.LastIndex(rest, "$")
+		if i < 0 {
+			return false, ErrUnsupportedHash
+		}
+		return constantTimeEqual(SHA256PwdSalt(password, rest[:i]), rest[i+1:]), nil
+	default:
+		return false, ErrUnsupportedHash
+	}
+}
+
+// HashPassword 使用指定算法生成自描述哈希，盐随机生成。
+func HashPassword(algo, password string) (string, error) {
+	switch algo {
+	case HashAlgoBcrypt:
+		out, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	case HashAlgoArgon2id:
+		salt, err := randomSalt()
+		if err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2MemoryKiB, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2MemoryKiB, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case HashAlgoPBKDF2SHA256:
+		salt, err := randomSalt()
+		if err != nil {
+			return "", err
+		}
+		key := pbkdf2.Key([]byte(password), salt, pbkdf2Iterations, pbkdf2KeyLen, sha256.New)
+		return fmt.Sprintf("$pbkdf2-sha256$%d$%s$%s", pbkdf2Iterations, ab64Encode(salt), ab64Encode(key)), nil
+	case HashAlgoSHA256:
+		salt, err := randomSalt()
+		if err != nil {
+			return "", err
+		}
+		s := hex.EncodeToString(salt)
+		return "$sha256$" + s + "$" + SHA256PwdSalt(password, s), nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedHash, algo)
+	}
+}
+
+// verifyArgon2id 校验 PHC 格式：$argon2id$v=19$m=<KiB>,t=<iter>,p=<threads>$<salt>$<hash>。
+func verifyArgon2id(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, ErrUnsupportedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrUnsupportedHash
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil || iterations == 0 || threads == 0 {
+		return false, ErrUnsupportedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrUnsupportedHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, ErrUnsupportedHash
+	}
+	got := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// verifyPBKDF2SHA256 校验 passlib 格式：$pbkdf2-sha256$<rounds>$<ab64 salt>$<ab64 hash>。
+func verifyPBKDF2SHA256(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return false, ErrUnsupportedHash
+	}
+	rounds, err := strconv.Atoi(parts[2])
+	if err != nil || rounds <= 0 {
+		return false, ErrUnsupportedHash
+	}
+	salt, err := ab64Decode(parts[3])
+	if err != nil {
+		return false, ErrUnsupportedHash
+	}
+	want, err := ab64Decode(parts[4])
+	if err != nil || len(want) == 0 {
+		return false, ErrUnsupportedHash
+	}
+	got := pbkdf2.Key([]byte(password), salt, rounds, len(want), sha256.New)
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// ab64Encode/ab64Decode 实现 passlib 的 "adapted base64"：以 '.' 代替 '+'，无填充。
+func ab64Encode(b []byte) string {
+	return strings.ReplaceAll(base64.RawStdEncoding.EncodeToString(b), "+", ".")
+}
+
+func ab64Decode(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.ReplaceAll(s, ".", "+"))
+}
+
+func randomSalt() ([]byte, error) {
+	salt := make([]byte, hashSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,94 @@
+package pluginutil
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSHA256PwdSalt(t *testing.T) {
+	t.Parallel()
+	const want = "7a37b85c8918eac19a9089c0fa5a2ab4dce3f90528dcdeec108b23ddf3607b99"
+	if got := SHA256PwdSalt("password", "salt"); got != want {
+		t.Fatalf("SHA256PwdSalt mismatch: got %q want %q", got, want)
+	}
+}
+
+func TestHashAlgorithm(t *testing.T) {
+	t.Parallel()
+	cases := map[string]string{
+		"7a37b85c8918eac19a9089c0fa5a2ab4dce3f90528dcdeec108b23ddf3607b99": HashAlgoLegacy,
+		"$2b$10$abcdefghijklmnopqrstuu":                                    HashAlgoBcrypt,
+		"$2y$10$abcdefghijklmnopqrstuu":                                    HashAlgoBcrypt,
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA":                     HashAlgoArgon2id,
+		"$pbkdf2-sha256$1000$c2FsdA$aGFzaA":                                HashAlgoPBKDF2SHA256,
+		"$sha256$salt$abcd":                                                HashAlgoSHA256,
+		"$md5$salt$abcd":                                                   "",
+	}
+	for in, want := range cases {
+		if got := HashAlgorithm(in); got != want {
+			t.Fatalf("HashAlgorithm(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestVerifyPasswordLegacy(t *testing.T) {
+	t.Parallel()
+	encoded := "7a37b85c8918eac19a9089c0fa5a2ab4dce3f90528dcdeec108b23ddf3607b99"
+	if ok, err := VerifyPassword("password", encoded, "salt"); err != nil || !ok {
+		t.Fatalf("legacy verify = (%v, %v), want (true, nil)", ok, err)
+	}
+	if ok, err := VerifyPassword("wrong", encoded, "salt"); err != nil || ok {
+		t.Fatalf("legacy verify wrong password = (%v, %v), want (false, nil)", ok, err)
+	}
+}
+
+func TestVerifyPasswordPBKDF2KnownVector(t *testing.T) {
+	t.Parallel()
+	// 由 Python hashlib.pbkdf2_hmac 生成，格式与 passlib 一致。
+	encoded := "$pbkdf2-sha256$1000$c2FsdHNhbHRzYWx0c2FsdA$8nX7hwFEzIB8aPajJTYK8weHQc5Ngz0pFVAKvSu4jQA"
+	if ok, err := VerifyPassword("password", encoded, ""); err != nil || !ok {
+		t.Fatalf("pbkdf2 verify = (%v, %v), want (true, nil)", ok, err)
+	}
+}
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	t.Parallel()
+	for _, algo := range []string{HashAlgoBcrypt, HashAlgoArgon2id, HashAlgoPBKDF2SHA256, HashAlgoSHA256} {
+		algo := algo
+		t.Run(algo, func(t *testing.T) {
+			t.Parallel()
+			encoded, err := HashPassword(algo, "s3cret")
+			if err != nil {
+				t.Fatalf("HashPassword(%q) error: %v", algo, err)
+			}
+			if got := HashAlgorithm(encoded); got != algo {
+				t.Fatalf("HashAlgorithm(%q) = %q, want %q", encoded, got, algo)
+			}
+			if ok, err := VerifyPassword("s3cret", encoded, ""); err != nil || !ok {
+				t.Fatalf("verify = (%v, %v), want (true, nil)", ok, err)
+			}
+			if ok, err := VerifyPassword("wrong", encoded, ""); err != nil || ok {
+				t.Fatalf("verify wrong password = (%v, %v), want (false, nil)", ok, err)
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordUnsupported(t *testing.T) {
+	t.Parallel()
+	for _, encoded := range []string{"$md5$salt$abcd", "$argon2id$broken", "$pbkdf2-sha256$x$y$z", "$sha256$nodelimiter"} {
+		if _, err := VerifyPassword("password", encoded, ""); !errors.Is(err, ErrUnsupportedHash) {
+			t.Fatalf("VerifyPassword(%q) error = %v, want ErrUnsupportedHash", encoded, err)
+		}
+	}
+}
+
+func TestParseHashAlgorithm(t *testing.T) {
+	t.Parallel()
+	if got, ok := ParseHashAlgorithm(" BCRYPT "); !ok || got != HashAlgoBcrypt {
+		t.Fatalf("ParseHashAlgorithm(bcrypt) = (%q, %v)", got, ok)
+	}
+	if _, ok := ParseHashAlgorithm("legacy"); ok {
+		t.Fatal("legacy should not be accepted as a target algorithm")
+	}
+}
@@ -0,0 +1,350 @@
+package pluginutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// 支持的 JWT 签名算法。
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+	JWTAlgES256 = "ES256"
+)
+
+var (
+	ErrJWTMalformed      = errors.New("malformed jwt")
+	ErrJWTUnsupportedAlg = errors.New("unsupported jwt algorithm")
+	ErrJWTUnknownKey     = errors.New("no jwt key for algorithm or kid")
+	ErrJWTSignature      = errors.New("invalid jwt signature")
+	ErrJWTExpired        = errors.New("jwt expired")
+	ErrJWTMissingExp     = errors.New("jwt missing exp")
+	ErrJWTNotYetValid    = errors.New("jwt not yet valid")
+	ErrJWTAudience       = errors.New("jwt audience mismatch")
+	ErrJWTIssuer         = errors.New("jwt issuer mismatch")
+)
+
+// jwtKey 为一把验签密钥；kid 为空表示不限定 kid。
+type jwtKey struct {
+	kid string
+	alg string
+	// hmac 为 HS256 共享密钥；pub 为 RS256/ES256 公钥。
+	hmac []byte
+	pub  crypto.PublicKey
+}
+
+// JWTKeySet 保存可用于验签的密钥集合。
+type JWTKeySet struct {
+	keys []jwtKey
+}
+
+// Len 返回密钥数量。
+func (s *JWTKeySet) Len() int {
+	return len(s.keys)
+}
+
+// AddHMACSecret 添加 HS256 共享密钥。
+func (s *JWTKeySet) AddHMACSecret(secret []byte) {
+	s.keys = append(s.keys, jwtKey{alg: JWTAlgHS256, hmac: append([]byte(nil), secret...)})
+}
+
+// AddPEM 添加 PEM 中的全部公钥（PUBLIC KEY / RSA PUBLIC KEY / CERTIFICATE），仅支持 RSA 与 P-256。
+func (s *JWTKeySet) AddPEM(data []byte) (int, error) {
+	n := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var pub any
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				pub = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		k, err := jwtKeyFromPublic("", pub)
+		if err != nil {
+			return n, err
+		}
+		s.keys = append(s.keys, k)
+		n++
+	}
+	if n == 0 {
+		return 0, errors.New("no public key found in pem")
+	}
+	return n, nil
+}
+
+// AddJWKS 添加 JWKS（{"keys":[...]}）中的 RSA / EC P-256 / oct 密钥；不支持的条目跳过。
+func (s *JWTKeySet) AddJWKS(data []byte) (int, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, jk := range set.Keys {
+		if jk.Use != "" && jk.Use != "sig" {
+			continue
+		}
+		var k jwtKey
+		switch jk.Kty {
+		case "RSA":
+			nb, err1 := base64.RawURLEncoding.DecodeString(jk.N)
+			eb, err2 := base64.RawURLEncoding.DecodeString(jk.E)
+			if err1 != nil || err2 != nil || len(nb) == 0 || len(eb) == 0 {
+				return n, fmt.Errorf("invalid rsa jwk %q", jk.Kid)
+			}
+			pub := &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(new(big.Int).SetBytes(eb).Int64())}
+			k = jwtKey{kid: jk.Kid, alg: JWTAlgRS256, pub: pub}
+		case "EC":
+			if jk.Crv != "P-256" {
+				continue
+			}
+			xb, err1 := base64.RawURLEncoding.DecodeString(jk.X)
+			yb, err2 := base64.RawURLEncoding.DecodeString(jk.Y)
+			if err1 != nil || err2 != nil {
+				return n, fmt.Errorf("invalid ec jwk %q", jk.Kid)
+			}
+			pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}
+			if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+				return n, fmt.Errorf("invalid ec jwk %q", jk.Kid)
+			}
+			k = jwtKey{kid: jk.Kid, alg: JWTAlgES256, pub: pub}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(jk.K)
+			if err != nil || len(secret) == 0 {
+				return n, fmt.Errorf("invalid oct jwk %q", jk.Kid)
+			}
+			k = jwtKey{kid: jk.Kid, alg: JWTAlgHS256, hmac: secret}
+		default:
+			continue
+		}
+		if jk.Alg != "" && jk.Alg != k.alg {
+			continue
+		}
+		s.keys = append(s.keys, k)
+		n++
+	}
+	return n, nil
+}
+
+func jwtKeyFromPublic(kid string, pub any) (jwtKey, error) {
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		return jwtKey{kid: kid, alg: JWTAlgRS256, pub: p}, nil
+	case *ecdsa.PublicKey:
+		if p.Curve != elliptic.P256() {
+			return jwtKey{}, errors.New("only P-256 ecdsa keys are supported")
+		}
+		return jwtKey{kid: kid, alg: JWTAlgES256, pub: p}, nil
+	default:
+		return jwtKey{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// JWTValidation 为声明校验参数；Audience/Issuer 为空表示不校验。
+type JWTValidation struct {
+	Audience string
+	Issuer   string
+	Leeway   time.Duration
+	Now      time.Time
+}
+
+// JWTClaims 为解析后的 payload，数字保留为 json.Number。
+type JWTClaims map[string]any
+
+// String 返回字符串类型的声明。
+func (c JWTClaims) String(name string) (string, bool) {
+	v, ok := c[name].(string)
+	return v, ok
+}
+
+// LooksLikeJWT 粗略判断字符串是否为 JWS 紧凑格式，用于区分口令与令牌。
+func LooksLikeJWT(s string) bool {
+	return strings.HasPrefix(s, "eyJ") && strings.Count(s, ".") == 2
+}
+
+// VerifyJWT 校验签名与 exp/nbf/aud/iss（exp 必须存在），返回 payload 声明。
+func VerifyJWT(token string, keys *JWTKeySet, v JWTValidation) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTMalformed
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrJWTMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	switch header.Alg {
+	case JWTAlgHS256, JWTAlgRS256, JWTAlgES256:
+	default:
+		// 包括 "none"：绝不接受未签名令牌。
+		return nil, ErrJWTUnsupportedAlg
+	}
+	if err := verifyJWTSignature(header.Alg, header.Kid, []byte(parts[0]+"."+parts[1]), sig, keys); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var claims JWTClaims
+	if err := dec.Decode(&claims); err != nil || claims == nil {
+		return nil, ErrJWTMalformed
+	}
+	if err := validateJWTClaims(claims, v); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func verifyJWTSignature(alg, kid string, signed, sig []byte, keys *JWTKeySet) error {
+	digest := sha256.Sum256(signed)
+	tried := false
+	for _, k := range keys.keys {
+		if k.alg != alg || (kid != "" && k.kid != "" && k.kid != kid) {
+			continue
+		}
+		tried = true
+		switch alg {
+		case JWTAlgHS256:
+			m := hmac.New(sha256.New, k.hmac)
+			m.Write(signed)
+			if hmac.Equal(m.Sum(nil), sig) {
+				return nil
+			}
+		case JWTAlgRS256:
+			if rsa.VerifyPKCS1v15(k.pub.(*rsa.PublicKey), crypto.SHA256, digest[:], sig) == nil {
+				return nil
+			}
+		case JWTAlgES256:
+			// JWS 的 ES256 签名为定长 r||s，而非 ASN.1。
+			if len(sig) != 64 {
+				return ErrJWTSignature
+			}
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			if ecdsa.Verify(k.pub.(*ecdsa.PublicKey), digest[:], r, s) {
+				return nil
+			}
+		}
+	}
+	if !tried {
+		return ErrJWTUnknownKey
+	}
+	return ErrJWTSignature
+}
+
+func validateJWTClaims(c JWTClaims, v JWTValidation) error {
+	now := v.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	// 不接受无 exp 的令牌，避免签发失误产生永不过期的凭据。
+	if exp, ok, err := numericClaim(c, "exp"); err != nil {
+		return err
+	} else if !ok {
+		return ErrJWTMissingExp
+	} else if !now.Before(exp.Add(v.Leeway)) {
+		return ErrJWTExpired
+	}
+	if nbf, ok, err := numericClaim(c, "nbf"); err != nil {
+		return err
+	} else if ok && now.Add(v.Leeway).Before(nbf) {
+		return ErrJWTNotYetValid
+	}
+	if v.Issuer != "" {
+		if iss, _ := c.String("iss"); iss != v.Issuer {
+			return ErrJWTIssuer
+		}
+	}
+	if v.Audience != "" && !audienceContains(c["aud"], v.Audience) {
+		return ErrJWTAudience
+	}
+	return nil
+}
+
+// numericClaim 读取 NumericDate 声明（秒，可带小数）。
+func numericClaim(c JWTClaims, name string) (time.Time, bool, error) {
+	raw, ok := c[name]
+	if !ok || raw == nil {
+		return time.Time{}, false, nil
+	}
+	n, ok := raw.(json.Number)
+	if !ok {
+		return time.Time{}, false, ErrJWTMalformed
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, ErrJWTMalformed
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true, nil
+}
+
+func audienceContains(aud any, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []any:
+		for _, item := range a {
+			if s, ok := item.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
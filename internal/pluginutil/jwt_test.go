@@ -0,0 +1,194 @@
+package pluginutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var jwtTestNow = time.Unix(1_700_000_000, 0)
+
+// signTestJWT 生成测试令牌；key 为 []byte（HS256）、*rsa.PrivateKey 或 *ecdsa.PrivateKey。
+func signTestJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	header := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(header) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		m := hmac.New(sha256.New, k)
+		m.Write([]byte(signed))
+		sig = m.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case nil:
+	default:
+		t.Fatalf("unsupported key %T", key)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifyJWTHS256(t *testing.T) {
+	keys := &JWTKeySet{}
+	keys.AddHMACSecret([]byte("old"))
+	keys.AddHMACSecret([]byte("new"))
+	tok := signTestJWT(t, JWTAlgHS256, "", []byte("new"), map[string]any{"sub": "alice", "exp": jwtTestNow.Unix() + 60})
+	if !LooksLikeJWT(tok) {
+		t.Fatalf("LooksLikeJWT(%q) = false", tok)
+	}
+	claims, err := VerifyJWT(tok, keys, JWTValidation{Now: jwtTestNow})
+	if err != nil {
+		t.Fatalf("VerifyJWT: %v", err)
+	}
+	if sub, _ := claims.String("sub"); sub != "alice" {
+		t.Fatalf("sub = %q", sub)
+	}
+
+	bad := signTestJWT(t, JWTAlgHS256, "", []byte("other"), map[string]any{"sub": "alice"})
+	if _, err := VerifyJWT(bad, keys, JWTValidation{Now: jwtTestNow}); !errors.Is(err, ErrJWTSignature) {
+		t.Fatalf("wrong secret err = %v", err)
+	}
+}
+
+func TestVerifyJWTRejectsNoneAndUnknownKey(t *testing.T) {
+	keys := &JWTKeySet{}
+	keys.AddHMACSecret([]byte("s"))
+	none := signTestJWT(t, "none", "", nil, map[string]any{"sub": "alice"})
+	if _, err := VerifyJWT(none, keys, JWTValidation{Now: jwtTestNow}); !errors.Is(err, ErrJWTUnsupportedAlg) {
+		t.Fatalf("alg none err = %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := signTestJWT(t, JWTAlgRS256, "", rsaKey, map[string]any{"sub": "alice"})
+	if _, err := VerifyJWT(rs, keys, JWTValidation{Now: jwtTestNow}); !errors.Is(err, ErrJWTUnknownKey) {
+		t.Fatalf("rs256 without keys err = %v", err)
+	}
+	if _, err := VerifyJWT("eyJ.a", keys, JWTValidation{}); !errors.Is(err, ErrJWTMalformed) {
+		t.Fatalf("malformed err = %v", err)
+	}
+}
+
+func TestVerifyJWTRS256PEM(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &JWTKeySet{}
+	if n, err := keys.AddPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})); err != nil || n != 1 {
+		t.Fatalf("AddPEM = %d, %v", n, err)
+	}
+	tok := signTestJWT(t, JWTAlgRS256, "", priv, map[string]any{"sub": "alice", "exp": jwtTestNow.Unix() + 60})
+	if _, err := VerifyJWT(tok, keys, JWTValidation{Now: jwtTestNow}); err != nil {
+		t.Fatalf("VerifyJWT: %v", err)
+	}
+	if _, err := keys.AddPEM([]byte("not pem")); err == nil {
+		t.Fatalf("AddPEM should reject input without keys")
+	}
+}
+
+func TestVerifyJWTES256JWKS(t *testing.T) {
+	k1, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	k2, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk := func(kid string, k *ecdsa.PrivateKey) string {
+		enc := base64.RawURLEncoding.EncodeToString
+		return fmt.Sprintf(`{"kty":"EC","crv":"P-256","kid":%q,"x":%q,"y":%q}`, kid, enc(k.X.FillBytes(make([]byte, 32))), enc(k.Y.FillBytes(make([]byte, 32))))
+	}
+	doc := `{"keys":[` + jwk("k1", k1) + `,` + jwk("k2", k2) + `,{"kty":"OKP","crv":"Ed25519","x":"AA"}]}`
+	keys := &JWTKeySet{}
+	if n, err := keys.AddJWKS([]byte(doc)); err != nil || n != 2 {
+		t.Fatalf("AddJWKS = %d, %v", n, err)
+	}
+	tok := signTestJWT(t, JWTAlgES256, "k2", k2, map[string]any{"sub": "alice", "exp": jwtTestNow.Unix() + 60})
+	if _, err := VerifyJWT(tok, keys, JWTValidation{Now: jwtTestNow}); err != nil {
+		t.Fatalf("VerifyJWT: %v", err)
+	}
+	// kid 指向另一把密钥时签名不匹配。
+	wrongKid := signTestJWT(t, JWTAlgES256, "k1", k2, map[string]any{"sub": "alice"})
+	if _, err := VerifyJWT(wrongKid, keys, JWTValidation{Now: jwtTestNow}); !errors.Is(err, ErrJWTSignature) {
+		t.Fatalf("wrong kid err = %v", err)
+	}
+}
+
+func TestVerifyJWTClaims(t *testing.T) {
+	secret := []byte("s")
+	keys := &JWTKeySet{}
+	keys.AddHMACSecret(secret)
+	v := JWTValidation{Audience: "mqtt", Issuer: "https://idp", Leeway: 5 * time.Second, Now: jwtTestNow}
+	now := jwtTestNow.Unix()
+	cases := []struct {
+		name   string
+		claims map[string]any
+		want   error
+	}{
+		{"ok", map[string]any{"aud": "mqtt", "iss": "https://idp", "exp": now + 1}, nil},
+		{"aud array", map[string]any{"aud": []string{"x", "mqtt"}, "iss": "https://idp", "exp": now + 1}, nil},
+		{"expired within leeway", map[string]any{"aud": "mqtt", "iss": "https://idp", "exp": now - 3}, nil},
+		{"expired", map[string]any{"aud": "mqtt", "iss": "https://idp", "exp": now - 10}, ErrJWTExpired},
+		{"missing exp", map[string]any{"aud": "mqtt", "iss": "https://idp"}, ErrJWTMissingExp},
+		{"not yet valid", map[string]any{"aud": "mqtt", "iss": "https://idp", "exp": now + 60, "nbf": now + 10}, ErrJWTNotYetValid},
+		{"audience", map[string]any{"aud": "other", "iss": "https://idp", "exp": now + 1}, ErrJWTAudience},
+		{"missing audience", map[string]any{"iss": "https://idp", "exp": now + 1}, ErrJWTAudience},
+		{"issuer", map[string]any{"aud": "mqtt", "iss": "evil", "exp": now + 1}, ErrJWTIssuer},
+		{"exp not numeric", map[string]any{"aud": "mqtt", "iss": "https://idp", "exp": "soon"}, ErrJWTMalformed},
+	}
+	for _, tc := range cases {
+		tok := signTestJWT(t, JWTAlgHS256, "", secret, tc.claims)
+		_, err := VerifyJWT(tok, keys, v)
+		if tc.want == nil && err != nil || tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestLooksLikeJWT(t *testing.T) {
+	for s, want := range map[string]bool{
+		"eyJhbGciOiJIUzI1NiJ9.e30.sig": true,
+		"secret-password":              false,
+		"eyJ.only-two":                 false,
+		"a.b.c":                        false,
+	} {
+		if got := LooksLikeJWT(s); got != want {
+			t.Errorf("LooksLikeJWT(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -6,6 +6,28 @@ type ClientInfo struct {
 	Username string
 	Peer     string
 	Protocol string
+	// ListenerPort 为客户端连接的监听端口，未知时为 0。
+	ListenerPort int
+	// Transport 为监听器传输方式（TransportTCP / TransportWebsockets），未知时为空。
+	Transport string
+}
+
+// 监听器传输方式。
+const (
+	TransportTCP        = "tcp"
+	TransportWebsockets = "websockets"
+)
+
+// TransportString 将 mosquitto_client_protocol 的返回值（mp_mqtt / mp_mqttsn / mp_websockets）转为传输方式。
+func TransportString(protocol int) string {
+	switch protocol {
+	case 0:
+		return TransportTCP
+	case 2:
+		return TransportWebsockets
+	default:
+		return ""
+	}
 }
 
 // ProtocolString 将协议版本号转为字符串。
@@ -0,0 +1,77 @@
+package pluginutil
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// PeerAddr 解析 mosquitto_client_address 等来源地址，兼容 "ip"、"ip:port"、"[ipv6]:port" 与带 zone 的写法。
+// IPv4 映射的 IPv6 地址（::ffff:a.b.c.d）会还原为 IPv4，便于与 IPv4 网段比较。
+func PeerAddr(peer string) (netip.Addr, bool) {
+	peer = strings.TrimSpace(peer)
+	if peer == "" {
+		return netip.Addr{}, false
+	}
+	if ap, err := netip.ParseAddrPort(peer); err == nil {
+		return ap.Addr().WithZone("").Unmap(), true
+	}
+	peer = strings.TrimSuffix(strings.TrimPrefix(peer, "["), "]")
+	addr, err := netip.ParseAddr(peer)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
+}
+
+// ParsePrefix 解析 CIDR；不带掩码的单个地址视为 /32 或 /128。
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if p.Addr().Is4In6() {
+			// ::ffff:10.0.0.0/104 这类写法还原为 IPv4 网段。
+			bits := p.Bits() - 96
+			if bits < 0 {
+				return netip.Prefix{}, fmt.Errorf("invalid prefix %q", s)
+			}
+			p = netip.PrefixFrom(p.Addr().Unmap(), bits)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ParsePrefixList 解析以逗号或空白分隔的 CIDR 列表；任一项非法即返回错误。
+func ParsePrefixList(s string) ([]netip.Prefix, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n'
+	})
+	out := make([]netip.Prefix, 0, len(fields))
+	for _, f := range fields {
+		p, err := ParsePrefix(f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// PrefixesContain 判断地址是否落在任一网段内。
+func PrefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package pluginutil
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPeerAddr(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input  string
+		want   string
+		wantOK bool
+	}{
+		{"192.0.2.10", "192.0.2.10", true},
+		{"192.0.2.10:51000", "192.0.2.10", true},
+		{"2001:db8::1", "2001:db8::1", true},
+		{"[2001:db8::1]:1883", "2001:db8::1", true},
+		{"[2001:db8::1]", "2001:db8::1", true},
+		{"fe80::1%eth0", "fe80::1", true},
+		{"::ffff:192.0.2.10", "192.0.2.10", true},
+		{"", "", false},
+		{"not-an-ip", "", false},
+	}
+	for _, tc := range tests {
+		got, ok := PeerAddr(tc.input)
+		if ok != tc.wantOK {
+			t.Fatalf("PeerAddr(%q) ok=%v, want %v", tc.input, ok, tc.wantOK)
+		}
+		if ok && got.String() != tc.want {
+			t.Fatalf("PeerAddr(%q) = %s, want %s", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestParsePrefixList(t *testing.T) {
+	t.Parallel()
+	got, err := ParsePrefixList("10.0.0.0/8, 192.0.2.7;2001:db8::/32 ::ffff:172.16.0.0/108")
+	if err != nil {
+		t.Fatalf("ParsePrefixList error: %v", err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.7/32", "2001:db8::/32", "172.16.0.0/12"}
+	if len(got) != len(want) {
+		t.Fatalf("ParsePrefixList len=%d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Fatalf("prefix[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if _, err := ParsePrefixList("10.0.0.0/33"); err == nil {
+		t.Fatalf("expected error for invalid prefix")
+	}
+}
+
+func TestPrefixesContain(t *testing.T) {
+	t.Parallel()
+	prefixes, _ := ParsePrefixList("10.0.0.0/8,2001:db8::/32")
+	cases := map[string]bool{
+		"10.1.2.3":    true,
+		"11.0.0.1":    false,
+		"2001:db8::5": true,
+		"2001:db9::5": false,
+	}
+	for in, want := range cases {
+		if got := PrefixesContain(prefixes, netip.MustParseAddr(in)); got != want {
+			t.Fatalf("PrefixesContain(%s) = %v, want %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package pluginutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PGRole 为连接用途：写入只能走主库，只读查询优先走副本。
+type PGRole int
+
+const (
+	PGPrimary PGRole = iota
+	PGReplica
+)
+
+func (r PGRole) String() string {
+	if r == PGReplica {
+		return "replica"
+	}
+	return "primary"
+}
+
+// ErrNoPGTarget 表示没有可用于该用途的健康节点。
+var ErrNoPGTarget = errors.New("no healthy postgres target")
+
+// PGCluster 管理按顺序排列的一组 DSN（通常第一个为主库，其余为只读副本）。
+// 节点角色以 pg_is_in_recovery() 为准：写入选第一个可写节点，副本提升为主库后自动接管写入；
+// 只读查询选第一个健康副本，没有副本时回落到主库。零值可用，未 Configure 时 Ensure 返回错误。
+// 启用熔断时每个节点有独立的熔断器，主库故障不影响从健康副本读取。
+type PGCluster struct {
+	// probeMu 串行化探测，避免并发请求同时为同一节点建池。
+	probeMu sync.Mutex
+
+	mu       sync.Mutex
+	opts     PGPoolOptions
+	nodes    []*pgNode
+	onSelect func(role PGRole, dsn string)
+	// selected 为各用途当前选中的节点下标，-1 表示需要重新探测。
+	selected [2]int
+	// gen 在 Configure/Close 时递增，丢弃跨越重载的探测结果。
+	gen    uint64
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+type pgNode struct {
+	dsn        string
+	pool       *pgxpool.Pool
+	healthy    bool
+	inRecovery bool
+	// breaker 为 nil 表示不熔断。
+	breaker *CircuitBreaker
+}
+
+// pgProbe 为一次节点探测的结果；pool 可能是本次新建的连接池。
+type pgProbe struct {
+	pool       *pgxpool.Pool
+	inRecovery bool
+	err        error
+}
+
+// Configure 设置节点列表并关闭旧连接池；onSelect 在某一用途选中的节点变化时调用（dsn 为空表示没有可用节点），可为 nil。
+func (c *PGCluster) Configure(dsns []string, opts PGPoolOptions, onSelect func(role PGRole, dsn string)) {
+	c.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opts = opts
+	c.onSelect = onSelect
+	c.nodes = make([]*pgNode, 0, len(dsns))
+	for _, dsn := range dsns {
+		c.nodes = append(c.nodes, &pgNode{dsn: dsn})
+	}
+	c.selected = [2]int{-1, -1}
+}
+
+// SetBreakers 为每个节点创建独立的熔断器（参数同 NewCircuitBreaker），onChange 额外带上节点 DSN，可为 nil。
+// Configure 会清除；threshold <= 0 表示不熔断。
+func (c *PGCluster) SetBreakers(threshold int, openFor time.Duration, onChange func(dsn string, from, to BreakerState)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range c.nodes {
+		n.breaker = nil
+		if threshold <= 0 {
+			continue
+		}
+		var notify func(from, to BreakerState)
+		if onChange != nil {
+			dsn := n.dsn
+			notify = func(from, to BreakerState) { onChange(dsn, from, to) }
+		}
+		n.breaker = NewCircuitBreaker(threshold, openFor, notify)
+	}
+}
+
+// Ensure 返回指定用途的连接池；尚未选中节点时同步探测节点，熔断器打开的节点不探测。
+// 全部候选节点的熔断器都打开时直接返回 ErrBreakerOpen，不等待超时。
+// 半开状态的探测名额只在 Ensure 内部使用并当场回报，调用方漏掉 Report 也不会卡住熔断器。
+func (c *PGCluster) Ensure(ctx context.Context, role PGRole) (*pgxpool.Pool, error) {
+	if p := c.selectedPool(role); p != nil {
+		return p, nil
+	}
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+	// 双检：等待期间其它请求可能已完成探测。
+	if p := c.selectedPool(role); p != nil {
+		return p, nil
+	}
+	err := c.check(ctx, true)
+	if p := c.selectedPool(role); p != nil {
+		return p, nil
+	}
+	if err == nil {
+		err = ErrNoPGTarget
+	}
+	return nil, err
+}
+
+// Target 返回指定用途当前选中的 DSN，未选中时返回空串。
+func (c *PGCluster) Target(role PGRole) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := c.selected[role]; c.nodes != nil && i >= 0 {
+		return c.nodes[i].dsn
+	}
+	return ""
+}
+
+// Report 在每次查询后回报结果：连接层错误把该节点标记为不健康并立即重新选择，同时计入该节点的熔断器；
+// 成功与 SQL 错误说明数据库可达，使熔断器复位。
+func (c *PGCluster) Report(p *pgxpool.Pool, err error) {
+	if p == nil {
+		return
+	}
+	connErr := IsPGConnError(err)
+	c.mu.Lock()
+	var breakers []*CircuitBreaker
+	for _, n := range c.nodes {
+		if n.pool != p {
+			continue
+		}
+		if n.breaker != nil {
+			breakers = append(breakers, n.breaker)
+		}
+		if connErr {
+			n.healthy = false
+		}
+	}
+	var changes []pgSelectChange
+	if connErr {
+		changes = c.reselectLocked()
+	}
+	notify := c.onSelect
+	c.mu.Unlock()
+	// 熔断器回调不持锁调用。
+	for _, b := range breakers {
+		b.Record(connErr)
+	}
+	notifyPGSelect(notify, changes)
+}
+
+// Check 探测全部节点（包括熔断器打开的节点）并更新选择，返回第一个探测错误；探测结果计入各节点的熔断器。
+func (c *PGCluster) Check(ctx context.Context) error {
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+	return c.check(ctx, false)
+}
+
+// StartHealthCheck 启动后台协程，每隔 interval 探测一次，单次探测超时为 timeout（<=0 表示不限）。
+func (c *PGCluster) StartHealthCheck(interval, timeout time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	c.mu.Lock()
+	if c.stopCh != nil {
+		c.mu.Unlock()
+		return
+	}
+	stopCh, doneCh := make(chan struct{}), make(chan struct{})
+	c.stopCh, c.doneCh = stopCh, doneCh
+	c.mu.Unlock()
+
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+			ctx, cancel := context.Background(), func() {}
+			if timeout > 0 {
+				ctx, cancel = context.WithTimeout(context.Background(), timeout)
+			}
+			_ = c.Check(ctx)
+			cancel()
+		}
+	}()
+}
+
+// Close 停止健康检查并关闭全部连接池；可重复调用。
+func (c *PGCluster) Close() {
+	c.mu.Lock()
+	stopCh, doneCh := c.stopCh, c.doneCh
+	c.stopCh, c.doneCh = nil, nil
+	c.mu.Unlock()
+	if stopCh != nil {
+		close(stopCh)
+		<-doneCh
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, n := range c.nodes {
+		if n.pool != nil {
+			n.pool.Close()
+			n.pool = nil
+		}
+		n.healthy = false
+	}
+	c.selected = [2]int{-1, -1}
+}
+
+func (c *PGCluster) selectedPool(role PGRole) *pgxpool.Pool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := c.selected[role]; c.nodes != nil && i >= 0 {
+		return c.nodes[i].pool
+	}
+	return nil
+}
+
+// check 并行探测全部节点，避免宕机节点耗尽整个超时；调用方需持有 probeMu。
+// gated=true 时跳过熔断器不放行的节点，全部跳过时返回 ErrBreakerOpen。
+func (c *PGCluster) check(ctx context.Context, gated bool) error {
+	c.mu.Lock()
+	if len(c.nodes) == 0 {
+		c.mu.Unlock()
+		return errors.New("postgres dsn not configured")
+	}
+	gen, opts := c.gen, c.opts
+	dsns := make([]string, len(c.nodes))
+	pools := make([]*pgxpool.Pool, len(c.nodes))
+	breakers := make([]*CircuitBreaker, len(c.nodes))
+	for i, n := range c.nodes {
+		dsns[i], pools[i], breakers[i] = n.dsn, n.pool, n.breaker
+	}
+	c.mu.Unlock()
+
+	skipped := make([]bool, len(dsns))
+	probed := 0
+	for i, b := range breakers {
+		if gated && b != nil && b.Allow() != nil {
+			skipped[i] = true
+			continue
+		}
+		probed++
+	}
+	if probed == 0 {
+		return ErrBreakerOpen
+	}
+
+	results := make([]pgProbe, len(dsns))
+	var wg sync.WaitGroup
+	for i := range dsns {
+		if skipped[i] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = probePGNode(ctx, dsns[i], pools[i], opts)
+		}(i)
+	}
+	wg.Wait()
+	for i, b := range breakers {
+		if b != nil && !skipped[i] {
+			b.Record(results[i].err != nil)
+		}
+	}
+
+	var firstErr error
+	c.mu.Lock()
+	stale := c.gen != gen
+	for i, r := range results {
+		if skipped[i] {
+			continue
+		}
+		if firstErr == nil && r.err != nil {
+			firstErr = r.err
+		}
+		if stale {
+			// 探测期间集群已重载：新建的池不再属于任何节点。
+			if r.pool != nil && r.pool != pools[i] {
+				r.pool.Close()
+			}
+			continue
+		}
+		n := c.nodes[i]
+		if r.pool != nil && n.pool == nil {
+			n.pool = r.pool
+		}
+		n.healthy = r.err == nil
+		n.inRecovery = r.inRecovery
+	}
+	var changes []pgSelectChange
+	if !stale {
+		changes = c.reselectLocked()
+	}
+	notify := c.onSelect
+	c.mu.Unlock()
+	notifyPGSelect(notify, changes)
+	return firstErr
+}
+
+func probePGNode(ctx context.Context, dsn string, pool *pgxpool.Pool, opts PGPoolOptions) pgProbe {
+	var r pgProbe
+	if pool == nil {
+		p, err := newPGPool(ctx, dsn, opts)
+		if err != nil {
+			r.err = err
+			return r
+		}
+		pool = p
+	}
+	r.pool = pool
+	r.err = pool.QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&r.inRecovery)
+	return r
+}
+
+type pgSelectChange struct {
+	role PGRole
+	dsn  string
+}
+
+// reselectLocked 按节点顺序重新选择主库与副本，返回发生变化的用途。
+func (c *PGCluster) reselectLocked() []pgSelectChange {
+	next := selectPGNodes(c.nodes)
+	var changes []pgSelectChange
+	for _, role := range []PGRole{PGPrimary, PGReplica} {
+		if next[role] == c.selected[role] {
+			continue
+		}
+		dsn := ""
+		if next[role] >= 0 {
+			dsn = c.nodes[next[role]].dsn
+		}
+		changes = append(changes, pgSelectChange{role: role, dsn: dsn})
+	}
+	c.selected = next
+	return changes
+}
+
+// selectPGNodes 返回各用途选中的节点下标：主库为第一个健康且可写的节点，副本为第一个健康的只读节点，没有时回落到主库。
+func selectPGNodes(nodes []*pgNode) [2]int {
+	sel := [2]int{-1, -1}
+	for i, n := range nodes {
+		if !n.healthy {
+			continue
+		}
+		if !n.inRecovery && sel[PGPrimary] < 0 {
+			sel[PGPrimary] = i
+		}
+		if n.inRecovery && sel[PGReplica] < 0 {
+			sel[PGReplica] = i
+		}
+	}
+	if sel[PGReplica] < 0 {
+		sel[PGReplica] = sel[PGPrimary]
+	}
+	return sel
+}
+
+func notifyPGSelect(fn func(role PGRole, dsn string), changes []pgSelectChange) {
+	if fn == nil {
+		return
+	}
+	for _, ch := range changes {
+		fn(ch.role, ch.dsn)
+	}
+}
+
+// IsPGConnError 判断错误是否来自连接层（建连失败、网络中断、超时），服务端返回的 SQL 错误与无结果不算。
+func IsPGConnError(err error) bool {
+	if err == nil || errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return false
+	}
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return pgconn.Timeout(err) || errors.As(err, &connectErr) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
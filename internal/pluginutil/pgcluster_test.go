@@ -0,0 +1,111 @@
+package pluginutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSelectPGNodes(t *testing.T) {
+	node := func(healthy, inRecovery bool) *pgNode { return &pgNode{healthy: healthy, inRecovery: inRecovery} }
+	cases := []struct {
+		name  string
+		nodes []*pgNode
+		want  [2]int
+	}{
+		{"primary only", []*pgNode{node(true, false)}, [2]int{0, 0}},
+		{"primary and replicas", []*pgNode{node(true, false), node(true, true), node(true, true)}, [2]int{0, 1}},
+		{"first replica down", []*pgNode{node(true, false), node(false, true), node(true, true)}, [2]int{0, 2}},
+		{"replicas down", []*pgNode{node(true, false), node(false, true)}, [2]int{0, 0}},
+		{"primary down", []*pgNode{node(false, false), node(true, true)}, [2]int{-1, 1}},
+		{"replica promoted", []*pgNode{node(false, false), node(true, false), node(true, true)}, [2]int{1, 2}},
+		{"all down", []*pgNode{node(false, false), node(false, true)}, [2]int{-1, -1}},
+	}
+	for _, tc := range cases {
+		if got := selectPGNodes(tc.nodes); got != tc.want {
+			t.Errorf("%s: got %v want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPGClusterReselectNotifies(t *testing.T) {
+	var got []string
+	var c PGCluster
+	c.Configure([]string{"primary", "replica"}, PGPoolOptions{}, func(role PGRole, dsn string) {
+		got = append(got, fmt.Sprintf("%s=%s", role, dsn))
+	})
+	c.mu.Lock()
+	c.nodes[0].healthy, c.nodes[1].healthy, c.nodes[1].inRecovery = true, true, true
+	changes := c.reselectLocked()
+	c.nodes[1].healthy = false
+	changes = append(changes, c.reselectLocked()...)
+	c.mu.Unlock()
+	notifyPGSelect(c.onSelect, changes)
+
+	want := []string{"primary=primary", "replica=replica", "replica=primary"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("notifications = %v, want %v", got, want)
+	}
+	if c.Target(PGReplica) != "primary" {
+		t.Fatalf("replica target = %q", c.Target(PGReplica))
+	}
+}
+
+func TestPGClusterEnsureError(t *testing.T) {
+	var c PGCluster
+	if _, err := c.Ensure(context.Background(), PGPrimary); err == nil {
+		t.Fatal("unconfigured cluster should return error")
+	}
+	c.Configure([]string{"://bad", "://bad-replica"}, PGPoolOptions{}, nil)
+	defer c.Close()
+	if p, err := c.Ensure(context.Background(), PGReplica); err == nil || p != nil {
+		t.Fatalf("Ensure = %p, %v; want error", p, err)
+	}
+}
+
+func TestIsPGConnError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{pgx.ErrNoRows, false},
+		{&pgconn.PgError{Code: "42P01"}, false},
+		{fmt.Errorf("query: %w", &pgconn.PgError{Code: "57P01"}), false},
+		{context.DeadlineExceeded, true},
+		{io.ErrUnexpectedEOF, true},
+		{errors.New("scan failed"), false},
+	}
+	for _, tc := range cases {
+		if got := IsPGConnError(tc.err); got != tc.want {
+			t.Errorf("IsPGConnError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestPGClusterEnsureWhenDSNReachable(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("set TEST_PG_DSN to run integration cluster test")
+	}
+	var c PGCluster
+	c.Configure([]string{dsn}, PGPoolOptions{}, nil)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	p, err := c.Ensure(ctx, PGReplica)
+	if err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	// 只有一个节点时读写共用同一连接池。
+	if p2, err := c.Ensure(ctx, PGPrimary); err != nil || p2 != p {
+		t.Fatalf("primary pool = %p, %v; want %p", p2, err, p)
+	}
+}
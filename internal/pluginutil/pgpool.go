@@ -2,18 +2,11 @@ package pluginutil
 
 import (
 	"context"
-	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// SharedPGPool 封装共享连接池状态，避免业务层直接操作锁和裸指针。
-type SharedPGPool struct {
-	mu   sync.RWMutex
-	pool *pgxpool.Pool
-}
-
 // PGPoolOptions 描述连接池参数；插件侧可以按业务场景选择默认值。
 type PGPoolOptions struct {
 	MaxConns          int32
@@ -52,39 +45,3 @@ func newPGPool(ctx context.Context, dsn string, opts PGPoolOptions) (*pgxpool.Po
 	}
 	return pool, nil
 }
-
-// Ensure 返回可复用连接池；created=true 表示本次新建成功。
-func (h *SharedPGPool) Ensure(ctx context.Context, dsn string, opts PGPoolOptions) (*pgxpool.Pool, bool, error) {
-	// 快路径：已有池时只读锁返回，避免不必要的互斥。
-	h.mu.RLock()
-	if h.pool != nil {
-		p := h.pool
-		h.mu.RUnlock()
-		return p, false, nil
-	}
-	h.mu.RUnlock()
-
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	// 双检锁：防止并发协程在锁升级期间重复创建连接池。
-	if h.pool != nil {
-		return h.pool, false, nil
-	}
-
-	p, err := newPGPool(ctx, dsn, opts)
-	if err != nil {
-		return nil, false, err
-	}
-	h.pool = p
-	return p, true, nil
-}
-
-// Close 关闭并清空池；可在插件重载/退出时重复调用。
-func (h *SharedPGPool) Close() {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if h.pool != nil {
-		h.pool.Close()
-		h.pool = nil
-	}
-}
@@ -0,0 +1,244 @@
+package pluginutil
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// SCRAMSHA256 为 MQTT v5 增强认证的方法名，同时也是验证器前缀。
+const SCRAMSHA256 = "SCRAM-SHA-256"
+
+const (
+	// SCRAMDefaultIterations 为新生成验证器的默认迭代次数（RFC 7677 建议不少于 4096）。
+	SCRAMDefaultIterations = 4096
+	scramNonceLen          = 18
+)
+
+var (
+	// ErrSCRAMMalformed 表示 SCRAM 消息或验证器格式错误。
+	ErrSCRAMMalformed = errors.New("malformed scram message")
+	// ErrSCRAMInvalidProof 表示客户端证明校验失败（密码错误）。
+	ErrSCRAMInvalidProof = errors.New("invalid scram proof")
+)
+
+// SCRAMVerifier 为服务端保存的 SCRAM 凭据，不含明文密码。
+// 文本格式与 PostgreSQL 相同：SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>（base64）。
+type SCRAMVerifier struct {
+	Iterations int
+	Salt       []byte
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// ParseSCRAMVerifier 解析验证器文本。
+func ParseSCRAMVerifier(s string) (SCRAMVerifier, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(s), SCRAMSHA256+"$")
+	if !ok {
+		return SCRAMVerifier{}, ErrSCRAMMalformed
+	}
+	params, keys, ok := strings.Cut(rest, "$")
+	if !ok {
+		return SCRAMVerifier{}, ErrSCRAMMalformed
+	}
+	iterText, saltText, ok1 := strings.Cut(params, ":")
+	storedText, serverText, ok2 := strings.Cut(keys, ":")
+	if !ok1 || !ok2 {
+		return SCRAMVerifier{}, ErrSCRAMMalformed
+	}
+	iter, err := strconv.Atoi(iterText)
+	if err != nil || iter <= 0 {
+		return SCRAMVerifier{}, ErrSCRAMMalformed
+	}
+	v := SCRAMVerifier{Iterations: iter}
+	for _, f := range []struct {
+		text string
+		dst  *[]byte
+	}{{saltText, &v.Salt}, {storedText, &v.StoredKey}, {serverText, &v.ServerKey}} {
+		b, err := base64.StdEncoding.DecodeString(f.text)
+		if err != nil || len(b) == 0 {
+			return SCRAMVerifier{}, ErrSCRAMMalformed
+		}
+		*f.dst = b
+	}
+	if len(v.StoredKey) != sha256.Size || len(v.ServerKey) != sha256.Size {
+		return SCRAMVerifier{}, ErrSCRAMMalformed
+	}
+	return v, nil
+}
+
+// String 返回验证器文本格式。
+func (v SCRAMVerifier) String() string {
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("%s$%d:%s$%s:%s", SCRAMSHA256, v.Iterations, enc(v.Salt), enc(v.StoredKey), enc(v.ServerKey))
+}
+
+// DeriveSCRAMVerifier 按 RFC 5802 从密码派生验证器。密码不做 SASLprep，调用方应使用 ASCII 密码。
+func DeriveSCRAMVerifier(password string, salt []byte, iterations int) SCRAMVerifier {
+	salted := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(salted, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	return SCRAMVerifier{
+		Iterations: iterations,
+		Salt:       append([]byte(nil), salt...),
+		StoredKey:  storedKey[:],
+		ServerKey:  hmacSHA256(salted, []byte("Server Key")),
+	}
+}
+
+// NewSCRAMVerifier 使用随机盐生成验证器文本。
+func NewSCRAMVerifier(password string, iterations int) (string, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return "", err
+	}
+	return DeriveSCRAMVerifier(password, salt, iterations).String(), nil
+}
+
+// SCRAMClientFirst 为解析后的 client-first-message。
+type SCRAMClientFirst struct {
+	Username string
+	Nonce    string
+	// gs2Header 与 bare 用于后续校验 channel binding 与拼接 AuthMessage。
+	gs2Header string
+	bare      string
+}
+
+// ParseSCRAMClientFirst 解析 client-first-message；不支持 channel binding（"p=" 报错）。
+func ParseSCRAMClientFirst(msg []byte) (SCRAMClientFirst, error) {
+	s := string(msg)
+	// gs2-header = cbind-flag "," [authzid] ","
+	flag, rest, ok := strings.Cut(s, ",")
+	if !ok || (flag != "n" && flag != "y") {
+		return SCRAMClientFirst{}, ErrSCRAMMalformed
+	}
+	authzid, bare, ok := strings.Cut(rest, ",")
+	if !ok {
+		return SCRAMClientFirst{}, ErrSCRAMMalformed
+	}
+	attrs := strings.Split(bare, ",")
+	if len(attrs) < 2 || !strings.HasPrefix(attrs[0], "n=") || !strings.HasPrefix(attrs[1], "r=") {
+		return SCRAMClientFirst{}, ErrSCRAMMalformed
+	}
+	for _, a := range attrs[2:] {
+		// 强制扩展 m= 不支持。
+		if strings.HasPrefix(a, "m=") {
+			return SCRAMClientFirst{}, ErrSCRAMMalformed
+		}
+	}
+	username, ok := decodeSASLName(attrs[0][2:])
+	nonce := attrs[1][2:]
+	if !ok || username == "" || nonce == "" {
+		return SCRAMClientFirst{}, ErrSCRAMMalformed
+	}
+	if authzid != "" {
+		az, ok := decodeSASLName(strings.TrimPrefix(authzid, "a="))
+		if !ok || !strings.HasPrefix(authzid, "a=") || az != username {
+			return SCRAMClientFirst{}, ErrSCRAMMalformed
+		}
+	}
+	return SCRAMClientFirst{Username: username, Nonce: nonce, gs2Header: flag + "," + authzid + ",", bare: bare}, nil
+}
+
+// SCRAMServer 保存一次 SCRAM 交换的服务端状态。
+type SCRAMServer struct {
+	first       SCRAMClientFirst
+	verifier    SCRAMVerifier
+	nonce       string
+	serverFirst string
+}
+
+// NewSCRAMServer 生成服务端随机数并返回 server-first-message。
+func NewSCRAMServer(first SCRAMClientFirst, verifier SCRAMVerifier) (*SCRAMServer, []byte, error) {
+	raw := make([]byte, scramNonceLen)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, nil, err
+	}
+	s, out := newSCRAMServer(first, verifier, base64.RawStdEncoding.EncodeToString(raw))
+	return s, out, nil
+}
+
+func newSCRAMServer(first SCRAMClientFirst, verifier SCRAMVerifier, serverNonce string) (*SCRAMServer, []byte) {
+	nonce := first.Nonce + serverNonce
+	serverFirst := fmt.Sprintf("r=%s,s=%s,i=%d", nonce, base64.StdEncoding.EncodeToString(verifier.Salt), verifier.Iterations)
+	return &SCRAMServer{first: first, verifier: verifier, nonce: nonce, serverFirst: serverFirst}, []byte(serverFirst)
+}
+
+// Final 校验 client-final-message，成功时返回 server-final-message（v=ServerSignature）。
+func (s *SCRAMServer) Final(msg []byte) ([]byte, error) {
+	text := string(msg)
+	i := strings.LastIndex(text, ",p=")
+	if i < 0 {
+		return nil, ErrSCRAMMalformed
+	}
+	withoutProof, proofText := text[:i], text[i+3:]
+	attrs := strings.Split(withoutProof, ",")
+	if len(attrs) < 2 || !strings.HasPrefix(attrs[0], "c=") || !strings.HasPrefix(attrs[1], "r=") {
+		return nil, ErrSCRAMMalformed
+	}
+	cbind, err := base64.StdEncoding.DecodeString(attrs[0][2:])
+	if err != nil || string(cbind) != s.first.gs2Header {
+		return nil, ErrSCRAMMalformed
+	}
+	if attrs[1][2:] != s.nonce {
+		return nil, ErrSCRAMMalformed
+	}
+	proof, err := base64.StdEncoding.DecodeString(proofText)
+	if err != nil || len(proof) != sha256.Size {
+		return nil, ErrSCRAMMalformed
+	}
+
+	authMessage := []byte(s.first.bare + "," + s.serverFirst + "," + withoutProof)
+	clientSignature := hmacSHA256(s.verifier.StoredKey, authMessage)
+	clientKey := make([]byte, sha256.Size)
+	for j := range clientKey {
+		clientKey[j] = proof[j] ^ clientSignature[j]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	if subtle.ConstantTimeCompare(storedKey[:], s.verifier.StoredKey) != 1 {
+		return nil, ErrSCRAMInvalidProof
+	}
+	serverSignature := hmacSHA256(s.verifier.ServerKey, authMessage)
+	return []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)), nil
+}
+
+// decodeSASLName 还原 saslname 中的 "=2C"/"=3D" 转义；其它 "=" 用法视为非法。
+func decodeSASLName(s string) (string, bool) {
+	if !strings.Contains(s, "=") {
+		return s, true
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '=' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", false
+		}
+		switch s[i+1 : i+3] {
+		case "2C":
+			b.WriteByte(',')
+		case "3D":
+			b.WriteByte('=')
+		default:
+			return "", false
+		}
+		i += 2
+	}
+	return b.String(), true
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
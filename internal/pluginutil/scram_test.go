@@ -0,0 +1,114 @@
+package pluginutil
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// RFC 7677 第 3 节示例：user/pencil。
+const (
+	rfcClientFirst = "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"
+	rfcServerNonce = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+	rfcServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	rfcClientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	rfcServerFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+)
+
+func rfcVerifier(t *testing.T) SCRAMVerifier {
+	t.Helper()
+	salt, err := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return DeriveSCRAMVerifier("pencil", salt, 4096)
+}
+
+func TestSCRAMRFC7677Exchange(t *testing.T) {
+	first, err := ParseSCRAMClientFirst([]byte(rfcClientFirst))
+	if err != nil {
+		t.Fatalf("ParseSCRAMClientFirst: %v", err)
+	}
+	if first.Username != "user" {
+		t.Fatalf("username = %q", first.Username)
+	}
+	s, out := newSCRAMServer(first, rfcVerifier(t), rfcServerNonce)
+	if string(out) != rfcServerFirst {
+		t.Fatalf("server-first = %q", out)
+	}
+	final, err := s.Final([]byte(rfcClientFinal))
+	if err != nil {
+		t.Fatalf("Final: %v", err)
+	}
+	if string(final) != rfcServerFinal {
+		t.Fatalf("server-final = %q", final)
+	}
+}
+
+func TestSCRAMInvalidProof(t *testing.T) {
+	first, _ := ParseSCRAMClientFirst([]byte(rfcClientFirst))
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	s, _ := newSCRAMServer(first, DeriveSCRAMVerifier("wrong", salt, 4096), rfcServerNonce)
+	if _, err := s.Final([]byte(rfcClientFinal)); !errors.Is(err, ErrSCRAMInvalidProof) {
+		t.Fatalf("Final = %v, want ErrSCRAMInvalidProof", err)
+	}
+}
+
+func TestSCRAMFinalMalformed(t *testing.T) {
+	first, _ := ParseSCRAMClientFirst([]byte(rfcClientFirst))
+	for _, msg := range []string{
+		"",
+		"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0",
+		"c=eSws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		"c=biws,r=other,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=short",
+	} {
+		s, _ := newSCRAMServer(first, rfcVerifier(t), rfcServerNonce)
+		if _, err := s.Final([]byte(msg)); !errors.Is(err, ErrSCRAMMalformed) {
+			t.Fatalf("Final(%q) = %v, want ErrSCRAMMalformed", msg, err)
+		}
+	}
+}
+
+func TestParseSCRAMClientFirst(t *testing.T) {
+	first, err := ParseSCRAMClientFirst([]byte("y,a=a=3Db=2Cc,n=a=3Db=2Cc,r=abc"))
+	if err != nil || first.Username != "a=b,c" || first.Nonce != "abc" {
+		t.Fatalf("escaped username: %+v, %v", first, err)
+	}
+	for _, msg := range []string{
+		"",
+		"p=tls-server-end-point,,n=user,r=abc",
+		"n,,r=abc,n=user",
+		"n,,n=user",
+		"n,,n=,r=abc",
+		"n,,n=us=er,r=abc",
+		"n,a=other,n=user,r=abc",
+		"n,,n=user,r=abc,m=ext",
+	} {
+		if _, err := ParseSCRAMClientFirst([]byte(msg)); !errors.Is(err, ErrSCRAMMalformed) {
+			t.Fatalf("ParseSCRAMClientFirst(%q) = %v, want ErrSCRAMMalformed", msg, err)
+		}
+	}
+}
+
+func TestSCRAMVerifierRoundTrip(t *testing.T) {
+	text, err := NewSCRAMVerifier("pencil", SCRAMDefaultIterations)
+	if err != nil {
+		t.Fatalf("NewSCRAMVerifier: %v", err)
+	}
+	v, err := ParseSCRAMVerifier(text)
+	if err != nil {
+		t.Fatalf("ParseSCRAMVerifier(%q): %v", text, err)
+	}
+	if v.String() != text || v.Iterations != SCRAMDefaultIterations {
+		t.Fatalf("round trip mismatch: %q vs %q", v.String(), text)
+	}
+	if got := DeriveSCRAMVerifier("pencil", v.Salt, v.Iterations).String(); got != text {
+		t.Fatalf("derived verifier mismatch")
+	}
+	for _, bad := range []string{"", "SCRAM-SHA-256$x:c2FsdA==$a:b", "md5$abc", "SCRAM-SHA-256$4096:c2FsdA==$c2FsdA==:c2FsdA=="} {
+		if _, err := ParseSCRAMVerifier(bad); err == nil {
+			t.Fatalf("ParseSCRAMVerifier(%q) should fail", bad)
+		}
+	}
+}
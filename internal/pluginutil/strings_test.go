@@ -87,3 +87,13 @@ func TestProtocolString(t *testing.T) {
 		})
 	}
 }
+
+func TestTransportString(t *testing.T) {
+	t.Parallel()
+	cases := map[int]string{0: TransportTCP, 1: "", 2: TransportWebsockets, 7: ""}
+	for in, want := range cases {
+		if got := TransportString(in); got != want {
+			t.Fatalf("TransportString(%d) = %q; want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// aclRule 对应 mqtt_acls 中的一条规则。
+type aclRule struct {
+	topic  string
+	access int
+	allow  bool
+}
+
+// expandACLPattern 替换规则中的 %u/%c/%t（%t 为租户）；替换值含通配符或为空时返回 false，避免越权匹配。
+func expandACLPattern(pattern string, info pluginutil.ClientInfo) (string, bool) {
+	if !strings.Contains(pattern, "%") {
+		return pattern, true
+	}
+	if strings.Contains(pattern, "%u") {
+		if info.Username == "" || strings.ContainsAny(info.Username, "+#/") {
+			return "", false
+		}
+		pattern = strings.ReplaceAll(pattern, "%u", info.Username)
+	}
+	if strings.Contains(pattern, "%c") {
+		if info.ClientID == "" || strings.ContainsAny(info.ClientID, "+#/") {
+			return "", false
+		}
+		pattern = strings.ReplaceAll(pattern, "%c", info.ClientID)
+	}
+	if strings.Contains(pattern, "%t") {
+		// 租户名已限制为字母、数字、下划线与连字符，不会含通配符。
+		tenant := tenantOf(info.Username)
+		if tenant == "" {
+			return "", false
+		}
+		pattern = strings.ReplaceAll(pattern, "%t", tenant)
+	}
+	return pattern, true
+}
+
+// aclFilterMatches 判断 ACL 过滤器是否覆盖目标主题。
+// 订阅检查时 topic 本身可能带通配符：仅当规则在同一层级也使用不窄于它的通配符时才算覆盖。
+func aclFilterMatches(filter, topic string) bool {
+	if filter == "" || topic == "" {
+		return false
+	}
+	// 与 MQTT 规范一致：以通配符开头的规则不匹配 $ 前缀主题。
+	if strings.HasPrefix(topic, "$") && (filter[0] == '+' || filter[0] == '#') {
+		return false
+	}
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, f := range fl {
+		if f == "#" {
+			return i == len(fl)-1
+		}
+		if i >= len(tl) {
+			return false
+		}
+		switch {
+		case f == "+":
+			if tl[i] == "#" {
+				return false
+			}
+		case f != tl[i]:
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
+
+// evaluateACL 按顺序匹配规则，返回首条命中规则的 allow；matched=false 表示无规则命中。
+func evaluateACL(rules []aclRule, info pluginutil.ClientInfo, topic string, access int) (allow bool, matched bool) {
+	for _, r := range rules {
+		if r.access&access == 0 {
+			continue
+		}
+		filter, ok := expandACLPattern(r.topic, info)
+		if !ok {
+			continue
+		}
+		if aclFilterMatches(filter, topic) {
+			return r.allow, true
+		}
+	}
+	return false, false
+}
+
+// aclRulesSQL 生成 ACL 规则查询：table 为规则表（已转义的限定名），tenantColumn=true 时按 tenant_id 列限定租户（$3）。
+func aclRulesSQL(table string, tenantColumn bool) string {
+	cond := ""
+	if tenantColumn {
+		cond = "\n  AND tenant_id IS NOT DISTINCT FROM $3"
+	}
+	return fmt.Sprintf(selectACLRulesSQL, table, cond)
+}
+
+// loadACLRules 读取与当前用户/客户端相关的 ACL 规则（限定在连接所属租户内），已按优先级排序。
+func loadACLRules(info pluginutil.ClientInfo) ([]aclRule, error) {
+	ctx := context.Background()
+	cancel := func() {}
+	// 保留 timeout<=0 时“无超时”的旧行为。
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	defer cancel()
+
+	p, err := poolHolder.Ensure(ctx, pluginutil.PGReplica)
+	if err != nil {
+		return nil, err
+	}
+	query, args := tenantACLQuery(info)
+	rows, err := p.Query(ctx, query, args...)
+	poolHolder.Report(p, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []aclRule
+	for rows.Next() {
+		var r aclRule
+		var access int16
+		if err := rows.Scan(&r.topic, &access, &r.allow); err != nil {
+			return nil, err
+		}
+		r.access = int(access)
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
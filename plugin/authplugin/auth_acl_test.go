@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func TestACLFilterMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{filter: "v1/d/c1/#", topic: "v1/d/c1/up", want: true},
+		{filter: "v1/d/c1/#", topic: "v1/d/c1", want: true},
+		{filter: "v1/d/+/up", topic: "v1/d/c1/up", want: true},
+		{filter: "v1/d/+/up", topic: "v1/d/c1/down", want: false},
+		{filter: "v1/d/c1", topic: "v1/d/c1/up", want: false},
+		{filter: "#", topic: "$SYS/broker/uptime", want: false},
+		{filter: "$SYS/#", topic: "$SYS/broker/uptime", want: true},
+		// 订阅过滤器：规则需覆盖请求中的通配符。
+		{filter: "v1/d/c1/#", topic: "v1/d/c1/#", want: true},
+		{filter: "v1/d/+/up", topic: "v1/d/#", want: false},
+		{filter: "v1/d/c1/+", topic: "v1/d/c1/#", want: false},
+		{filter: "v1/d/+/up", topic: "v1/d/+/up", want: true},
+	}
+	for _, tc := range tests {
+		if got := aclFilterMatches(tc.filter, tc.topic); got != tc.want {
+			t.Fatalf("aclFilterMatches(%q, %q) = %v, want %v", tc.filter, tc.topic, got, tc.want)
+		}
+	}
+}
+
+func TestExpandACLPattern(t *testing.T) {
+	info := pluginutil.ClientInfo{Username: "alice", ClientID: "c1"}
+	if got, ok := expandACLPattern("v1/%u/%c/#", info); !ok || got != "v1/alice/c1/#" {
+		t.Fatalf("expandACLPattern = (%q, %v), want (%q, true)", got, ok, "v1/alice/c1/#")
+	}
+	if _, ok := expandACLPattern("v1/d/%c/#", pluginutil.ClientInfo{Username: "alice", ClientID: "c/#"}); ok {
+		t.Fatal("expandACLPattern should reject client id containing wildcards")
+	}
+	if _, ok := expandACLPattern("v1/d/%c/#", pluginutil.ClientInfo{Username: "alice"}); ok {
+		t.Fatal("expandACLPattern should reject empty client id")
+	}
+}
+
+func TestEvaluateACL(t *testing.T) {
+	info := pluginutil.ClientInfo{Username: "alice", ClientID: "c1"}
+	rules := []aclRule{
+		{topic: "v1/d/%c/cmd/#", access: mosqACLWrite, allow: false},
+		{topic: "v1/d/%c/#", access: mosqACLRead | mosqACLWrite | mosqACLSubscribe, allow: true},
+	}
+
+	if allow, matched := evaluateACL(rules, info, "v1/d/c1/up", mosqACLWrite); !allow || !matched {
+		t.Fatalf("write own topic: allow=%v matched=%v", allow, matched)
+	}
+	if allow, matched := evaluateACL(rules, info, "v1/d/c1/cmd/reboot", mosqACLWrite); allow || !matched {
+		t.Fatalf("deny rule should win: allow=%v matched=%v", allow, matched)
+	}
+	if allow, matched := evaluateACL(rules, info, "v1/d/c1/cmd/reboot", mosqACLRead); !allow || !matched {
+		t.Fatalf("read cmd topic: allow=%v matched=%v", allow, matched)
+	}
+	if allow, matched := evaluateACL(rules, info, "v1/d/c2/up", mosqACLWrite); allow || matched {
+		t.Fatalf("other client topic: allow=%v matched=%v", allow, matched)
+	}
+}
+
+func TestRunACLCheckDefer(t *testing.T) {
+	tests := []pluginutil.ClientInfo{
+		{ClientID: "c1", Username: ""},
+		{ClientID: "c1", Username: "_ops"},
+	}
+	for _, info := range tests {
+		got := runACLCheck(0, info, "v1/d/c1/up", mosqACLWrite)
+		if int(got) != mosqErrDefer {
+			t.Fatalf("defer mismatch for %q: got=%d", info.Username, int(got))
+		}
+	}
+}
+
+func TestACLCheckCbNilEventData(t *testing.T) {
+	got := acl_check_cb_c(0, nil, nil)
+	if int(got) != mosqErrACLDenied {
+		t.Fatalf("code mismatch for nil event_data: got=%d want=%d", int(got), mosqErrACLDenied)
+	}
+}
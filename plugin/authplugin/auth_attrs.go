@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// accountAttrs 为凭据校验之外、需要在缓存命中后仍然生效的账户属性。
+type accountAttrs struct {
+	// validFrom/validUntil 为零值表示不限制。
+	validFrom  time.Time
+	validUntil time.Time
+	// allowedCIDRs 为 nil 表示不限制来源地址；非 nil 的空切片表示配置无法解析，拒绝所有来源。
+	allowedCIDRs []netip.Prefix
+	// acl 为认证后端随结果授予的连接级 ACL（HTTP 认证响应），认证通过后登记到 connACLs。
+	acl connACL
+	// maxConnections 为账户允许的并发连接数，0 表示不限制。
+	maxConnections int
+	// allowedProtocols / allowedListeners 为 nil 表示不限制；非 nil 的空切片表示配置无法解析，一律拒绝。
+	allowedProtocols []string
+	allowedListeners []string
+}
+
+// accountWindowReason 检查账户有效期；在有效期内返回空串。valid_until 为开区间上界。
+func accountWindowReason(attrs accountAttrs, now time.Time) string {
+	if !attrs.validFrom.IsZero() && now.Before(attrs.validFrom) {
+		return authReasonAccountNotYetValid
+	}
+	if !attrs.validUntil.IsZero() && !now.Before(attrs.validUntil) {
+		return authReasonAccountExpired
+	}
+	return ""
+}
+
+// peerAllowed 判断来源地址是否在账户允许的网段内；无法解析的来源地址在受限账户下一律拒绝。
+func peerAllowed(attrs accountAttrs, peer string) bool {
+	if attrs.allowedCIDRs == nil {
+		return true
+	}
+	addr, ok := pluginutil.PeerAddr(peer)
+	if !ok {
+		return false
+	}
+	return pluginutil.PrefixesContain(attrs.allowedCIDRs, addr)
+}
+
+// checkAccountAttrs 在凭据校验通过后检查账户属性，返回拒绝原因；空串表示放行。
+func checkAccountAttrs(attrs accountAttrs, info pluginutil.ClientInfo, now time.Time) string {
+	if r := accountWindowReason(attrs, now); r != "" {
+		return r
+	}
+	if !peerAllowed(attrs, info.Peer) {
+		return authReasonPeerNotAllowed
+	}
+	return connRestrictionReason(attrs.allowedProtocols, attrs.allowedListeners, info)
+}
+
+// columnPrefixes 解析 allowed_cidrs 列：支持 cidr[]/inet[]/text[] 以及逗号分隔的文本。
+// NULL 或空列表返回 nil（不限制）。
+func columnPrefixes(v any) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	add := func(item any) error {
+		switch x := item.(type) {
+		case nil:
+			return nil
+		case netip.Prefix:
+			// 统一经 ParsePrefix 归一化（IPv4 映射地址还原、主机位清零）。
+			p, err := pluginutil.ParsePrefix(x.String())
+			if err != nil {
+				return err
+			}
+			out = append(out, p)
+		case netip.Addr:
+			p, err := pluginutil.ParsePrefix(x.String())
+			if err != nil {
+				return err
+			}
+			out = append(out, p)
+		case string:
+			ps, err := pluginutil.ParsePrefixList(x)
+			if err != nil {
+				return err
+			}
+			out = append(out, ps...)
+		default:
+			return fmt.Errorf("unsupported allowed_cidrs element %T", item)
+		}
+		return nil
+	}
+	switch x := v.(type) {
+	case []any:
+		for _, item := range x {
+			if err := add(item); err != nil {
+				return nil, err
+			}
+		}
+	case []string:
+		for _, item := range x {
+			if err := add(item); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if err := add(v); err != nil {
+			return nil, err
+		}
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func TestAccountWindowReason(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name  string
+		attrs accountAttrs
+		want  string
+	}{
+		{"unbounded", accountAttrs{}, ""},
+		{"inside", accountAttrs{validFrom: now.Add(-time.Hour), validUntil: now.Add(time.Hour)}, ""},
+		{"not yet valid", accountAttrs{validFrom: now.Add(time.Minute)}, authReasonAccountNotYetValid},
+		{"expired", accountAttrs{validUntil: now.Add(-time.Minute)}, authReasonAccountExpired},
+		{"until is exclusive", accountAttrs{validUntil: now}, authReasonAccountExpired},
+		{"from is inclusive", accountAttrs{validFrom: now}, ""},
+	}
+	for _, c := range cases {
+		if got := accountWindowReason(c.attrs, now); got != c.want {
+			t.Fatalf("%s: got %q want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPeerAllowed(t *testing.T) {
+	restricted := accountAttrs{allowedCIDRs: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}}
+	cases := []struct {
+		name  string
+		attrs accountAttrs
+		peer  string
+		want  bool
+	}{
+		{"unrestricted", accountAttrs{}, "203.0.113.9", true},
+		{"unrestricted unknown peer", accountAttrs{}, "", true},
+		{"ipv4 inside", restricted, "10.2.3.4", true},
+		{"ipv4 with port", restricted, "10.2.3.4:50123", true},
+		{"ipv4 outside", restricted, "192.0.2.1", false},
+		{"ipv6 inside", restricted, "[2001:db8::7]:1883", true},
+		{"ipv4 mapped", restricted, "::ffff:10.9.9.9", true},
+		{"unparseable peer", restricted, "unix-socket", false},
+		{"invalid config denies", accountAttrs{allowedCIDRs: []netip.Prefix{}}, "10.2.3.4", false},
+	}
+	for _, c := range cases {
+		if got := peerAllowed(c.attrs, c.peer); got != c.want {
+			t.Fatalf("%s: peerAllowed = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCheckAccountAttrsOrder(t *testing.T) {
+	now := time.Now()
+	attrs := accountAttrs{
+		validUntil:   now.Add(-time.Minute),
+		allowedCIDRs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	}
+	info := pluginutil.ClientInfo{Peer: "192.0.2.1"}
+	if got := checkAccountAttrs(attrs, info, now); got != authReasonAccountExpired {
+		t.Fatalf("expired account should be reported first, got %q", got)
+	}
+	attrs.validUntil = time.Time{}
+	if got := checkAccountAttrs(attrs, info, now); got != authReasonPeerNotAllowed {
+		t.Fatalf("got %q, want %q", got, authReasonPeerNotAllowed)
+	}
+	info.Peer = "10.0.0.1"
+	if got := checkAccountAttrs(attrs, info, now); got != "" {
+		t.Fatalf("got %q, want allow", got)
+	}
+	attrs.allowedProtocols = []string{"MQTT/5.0"}
+	attrs.allowedListeners = []string{"tcp"}
+	info.Protocol, info.Transport = "MQTT/3.1.1", "websockets"
+	if got := checkAccountAttrs(attrs, info, now); got != authReasonProtocolNotAllowed {
+		t.Fatalf("got %q, want %q", got, authReasonProtocolNotAllowed)
+	}
+	info.Protocol = "MQTT/5.0"
+	if got := checkAccountAttrs(attrs, info, now); got != authReasonListenerNotAllowed {
+		t.Fatalf("got %q, want %q", got, authReasonListenerNotAllowed)
+	}
+}
+
+func TestColumnPrefixes(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      any
+		want    []string
+		wantErr bool
+	}{
+		{"null", nil, nil, false},
+		{"empty text", "", nil, false},
+		{"text list", "10.0.0.0/8, 192.0.2.1", []string{"10.0.0.0/8", "192.0.2.1/32"}, false},
+		{"text array", []any{"2001:db8::/32", nil}, []string{"2001:db8::/32"}, false},
+		{"cidr array", []any{netip.MustParsePrefix("172.16.0.0/12")}, []string{"172.16.0.0/12"}, false},
+		{"inet array", []any{netip.MustParseAddr("192.0.2.5")}, []string{"192.0.2.5/32"}, false},
+		{"empty array", []any{}, nil, false},
+		{"invalid", "10.0.0.0/40", nil, true},
+		{"unsupported", int32(1), nil, true},
+	}
+	for _, c := range cases {
+		got, err := columnPrefixes(c.in)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%s: err=%v, wantErr=%v", c.name, err, c.wantErr)
+		}
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: got %v, want %v", c.name, got, c.want)
+		}
+		for i := range c.want {
+			if got[i].String() != c.want[i] {
+				t.Fatalf("%s: prefix[%d]=%s, want %s", c.name, i, got[i], c.want[i])
+			}
+		}
+	}
+}
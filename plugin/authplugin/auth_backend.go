@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// 认证链后端名称，用于 auth_backends 配置。
+const (
+	authBackendJWT      = "jwt"
+	authBackendFile     = "file"
+	authBackendHTTP     = "http"
+	authBackendCache    = "cache"
+	authBackendPostgres = "postgres"
+)
+
+// defaultAuthBackends 为未配置 auth_backends 时的顺序，未启用的后端自动跳过。
+var defaultAuthBackends = []string{authBackendJWT, authBackendFile, authBackendHTTP, authBackendCache, authBackendPostgres}
+
+// authDecision 为单个后端的判定。
+type authDecision int
+
+const (
+	// authNext 表示后端不认识该账户或不处理该凭据，交给链上的下一个后端。
+	authNext authDecision = iota
+	authAllow
+	authDeny
+)
+
+// authRequest 为一次 BASIC_AUTH 的输入，在链上各后端之间共享。
+type authRequest struct {
+	info     pluginutil.ClientInfo
+	password string
+	now      time.Time
+	// cache 后端未命中时记录键与代数，postgres 后端据此回填缓存。
+	cache    *authCache
+	cacheKey authCacheKey
+	cacheGen uint64
+}
+
+// authOutcome 为后端的判定结果。
+type authOutcome struct {
+	decision authDecision
+	reason   string
+	attrs    accountAttrs
+	// err 非空表示后端不可用，由链统一按 fail_open 处理：reason 为拒绝原因，failOpenReason 为放行原因。
+	err            error
+	failOpenReason string
+}
+
+// authenticator 为认证链上的一个后端。
+type authenticator interface {
+	Name() string
+	Authenticate(req *authRequest) authOutcome
+}
+
+// parseAuthBackends 解析逗号分隔的后端列表；名称未知或重复时返回 false。
+func parseAuthBackends(v string) ([]string, bool) {
+	var out []string
+	seen := map[string]bool{}
+	for _, item := range strings.Split(v, ",") {
+		name := strings.ToLower(strings.TrimSpace(item))
+		switch name {
+		case "":
+			continue
+		case authBackendJWT, authBackendFile, authBackendHTTP, authBackendCache, authBackendPostgres:
+		default:
+			return nil, false
+		}
+		if seen[name] {
+			return nil, false
+		}
+		seen[name] = true
+		out = append(out, name)
+	}
+	return out, len(out) > 0
+}
+
+// buildAuthChain 按名称构造认证链，依赖当前已初始化的后端全局变量。
+// explicit=true 时列出未启用的后端视为配置错误；否则（默认顺序）直接跳过。
+func buildAuthChain(names []string, explicit bool) ([]authenticator, error) {
+	var chain []authenticator
+	for _, name := range names {
+		var a authenticator
+		missing := ""
+		switch name {
+		case authBackendJWT:
+			if jwtKeys == nil {
+				missing = "jwt_enabled"
+			} else {
+				a = jwtAuthenticator{cfg: jwtCfg, keys: jwtKeys}
+			}
+		case authBackendFile:
+			if authFile == nil {
+				missing = "auth_file"
+			} else {
+				a = fileAuthenticator{store: authFile}
+			}
+		case authBackendHTTP:
+			if httpAuth == nil {
+				missing = "http_auth_url"
+			} else {
+				a = httpAuthenticator{backend: httpAuth}
+			}
+		case authBackendCache:
+			if credentialCache == nil {
+				missing = "auth_cache_size"
+			} else {
+				a = cacheAuthenticator{cache: credentialCache}
+			}
+		case authBackendPostgres:
+			a = postgresAuthenticator{}
+		default:
+			return nil, fmt.Errorf("unknown auth backend %q", name)
+		}
+		if missing != "" {
+			if explicit {
+				return nil, fmt.Errorf("auth backend %q requires %s", name, missing)
+			}
+			continue
+		}
+		chain = append(chain, a)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no auth backend enabled")
+	}
+	return chain, nil
+}
+
+// authChainNames 返回认证链的后端名称，用于日志。
+func authChainNames(chain []authenticator) string {
+	names := make([]string, 0, len(chain))
+	for _, a := range chain {
+		names = append(names, a.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// runAuthChain 依次询问各后端，第一个 allow/deny 即为最终结果。
+// 后端错误不再向后传递，与单一数据库时一致按 fail_open 处理；全部后端都交给下一个时按拒绝处理，
+// 原因取第一个后端给出的原因（如 user_not_found）。
+func runAuthChain(chain []authenticator, session uintptr, info pluginutil.ClientInfo, password string, now time.Time) int {
+	req := &authRequest{info: info, password: password, now: now}
+	nextReason := ""
+	for _, a := range chain {
+		out := a.Authenticate(req)
+		if out.err != nil {
+			log(mosqLogWarning, "auth-plugin auth error", map[string]any{"error": out.err.Error(), "backend": a.Name()})
+			if failOpen {
+				log(mosqLogInfo, "auth-plugin: fail_open allow auth", map[string]any{"reason": out.reason, "backend": a.Name()})
+				recordAuthResult(info, true, out.failOpenReason)
+				return mosqErrSuccess
+			}
+			recordAuthResult(info, false, out.reason)
+			return mosqErrAuth
+		}
+		if out.decision == authNext {
+			if nextReason == "" {
+				nextReason = out.reason
+			}
+			continue
+		}
+		// 有效期、来源地址等只在凭据正确时检查，且在缓存之后按当前连接计算，缓存期间变化同样生效。
+		if out.decision == authAllow {
+			if r := checkAccountAttrs(out.attrs, info, now); r != "" {
+				out = authOutcome{decision: authDeny, reason: r}
+			}
+		}
+		return finishAuth(session, info, out, now)
+	}
+	if nextReason == "" {
+		nextReason = authReasonUserNotFound
+	}
+	return finishAuth(session, info, authOutcome{decision: authDeny, reason: nextReason}, now)
+}
+
+// finishAuth 记录最终判定：检查并发连接数，更新锁定计数，放行时登记连接级 ACL 与会话有效期。
+func finishAuth(session uintptr, info pluginutil.ClientInfo, out authOutcome, now time.Time) int {
+	allow := out.decision == authAllow
+	if allow {
+		if r := admitConnection(session, info, out.attrs); r != "" {
+			out, allow = authOutcome{decision: authDeny, reason: r}, false
+		}
+	}
+	observeAuthResult(info, allow, out.reason, now)
+	code := mosqErrAuth
+	if allow {
+		code = mosqErrSuccess
+		if session != 0 {
+			connACLs.Put(session, out.attrs.acl)
+			authSessions.Track(session, authSession{clientID: info.ClientID, username: info.Username, validUntil: out.attrs.validUntil})
+		}
+	}
+	superuser := allow && out.attrs.acl.superuser
+	if superuser {
+		log(mosqLogInfo, "auth-plugin: superuser login", map[string]any{"username": info.Username, "client_id": info.ClientID, "reason": out.reason})
+	}
+	recordAuthOutcome(info, allow, out.reason, superuser)
+	return code
+}
+
+// dbOutcome 把 dbAuth 的结果映射为链上判定；账户不存在时交给下一个后端。
+func dbOutcome(allow bool, reason string, attrs accountAttrs) authOutcome {
+	switch {
+	case allow:
+		return authOutcome{decision: authAllow, reason: reason, attrs: attrs}
+	case reason == authReasonUserNotFound:
+		return authOutcome{decision: authNext, reason: reason}
+	default:
+		return authOutcome{decision: authDeny, reason: reason}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// stubAuthenticator 返回固定判定并记录调用次数。
+type stubAuthenticator struct {
+	name  string
+	out   authOutcome
+	calls *int
+}
+
+func (s stubAuthenticator) Name() string { return s.name }
+
+func (s stubAuthenticator) Authenticate(*authRequest) authOutcome {
+	*s.calls++
+	return s.out
+}
+
+func TestParseAuthBackends(t *testing.T) {
+	got, ok := parseAuthBackends(" Cache, postgres ,http,file ")
+	if want := []string{"cache", "postgres", "http", "file"}; !ok || !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseAuthBackends = %v, %v", got, ok)
+	}
+	for _, v := range []string{"", " , ", "postgres,ldap", "postgres,postgres"} {
+		if _, ok := parseAuthBackends(v); ok {
+			t.Errorf("%q should be rejected", v)
+		}
+	}
+}
+
+func TestBuildAuthChain(t *testing.T) {
+	defer func() { authFile = nil }()
+	authFile = &authFileStore{users: map[string]string{}}
+
+	chain, err := buildAuthChain(defaultAuthBackends, false)
+	if err != nil || authChainNames(chain) != "file,postgres" {
+		t.Fatalf("default chain = %q, %v", authChainNames(chain), err)
+	}
+	if _, err := buildAuthChain([]string{authBackendFile, authBackendHTTP}, true); err == nil {
+		t.Fatalf("explicit http without http_auth_url should fail")
+	}
+	chain, err = buildAuthChain([]string{authBackendPostgres, authBackendFile}, true)
+	if err != nil || authChainNames(chain) != "postgres,file" {
+		t.Fatalf("explicit chain = %q, %v", authChainNames(chain), err)
+	}
+}
+
+func TestRunAuthChain(t *testing.T) {
+	var rec recordedBatches
+	authEvents = startAuthEventQueue(authEventQueueConfig{size: 16, batchSize: 16, flushInterval: time.Hour}, rec.write)
+	defer func() { failOpen = false }()
+
+	info := pluginutil.ClientInfo{Username: "svc", ClientID: "c1"}
+	var nFirst, nSecond int
+	run := func(first, second authOutcome) int {
+		nFirst, nSecond = 0, 0
+		chain := []authenticator{
+			stubAuthenticator{name: "first", out: first, calls: &nFirst},
+			stubAuthenticator{name: "second", out: second, calls: &nSecond},
+		}
+		return runAuthChain(chain, 0, info, "pwd", time.Now())
+	}
+	allow := authOutcome{decision: authAllow, reason: authReasonFileOK}
+	next := authOutcome{decision: authNext, reason: authReasonUserNotFound}
+	backendErr := authOutcome{decision: authDeny, reason: authReasonDBError, err: errors.New("down"), failOpenReason: authReasonDBErrorFailOpen}
+
+	if code := run(allow, next); code != mosqErrSuccess || nSecond != 0 {
+		t.Fatalf("allow should stop the chain: code=%d second=%d", code, nSecond)
+	}
+	if code := run(authOutcome{decision: authDeny, reason: authReasonInvalidPassword}, allow); code != mosqErrAuth || nSecond != 0 {
+		t.Fatalf("deny should stop the chain: code=%d second=%d", code, nSecond)
+	}
+	if code := run(next, allow); code != mosqErrSuccess || nSecond != 1 {
+		t.Fatalf("next should fall through: code=%d second=%d", code, nSecond)
+	}
+	if code := run(next, authOutcome{decision: authNext}); code != mosqErrAuth {
+		t.Fatalf("exhausted chain should deny: code=%d", code)
+	}
+	if code := run(backendErr, allow); code != mosqErrAuth || nSecond != 0 {
+		t.Fatalf("backend error should deny without fallback: code=%d second=%d", code, nSecond)
+	}
+	failOpen = true
+	if code := run(backendErr, authOutcome{decision: authDeny}); code != mosqErrSuccess || nSecond != 0 {
+		t.Fatalf("fail_open should allow on backend error: code=%d second=%d", code, nSecond)
+	}
+	expired := authOutcome{decision: authAllow, reason: authReasonOK, attrs: accountAttrs{validUntil: time.Now().Add(-time.Hour)}}
+	if code := run(expired, allow); code != mosqErrAuth {
+		t.Fatalf("expired account should be denied: code=%d", code)
+	}
+
+	stopAuthEventQueue()
+	var reasons []string
+	for _, b := range rec.batches {
+		for _, ev := range b {
+			reasons = append(reasons, ev.reason)
+		}
+	}
+	want := []string{authReasonFileOK, authReasonInvalidPassword, authReasonFileOK, authReasonUserNotFound,
+		authReasonDBError, authReasonDBErrorFailOpen, authReasonAccountExpired}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Fatalf("event reasons = %v, want %v", reasons, want)
+	}
+}
+
+func TestRunAuthChainSuperuser(t *testing.T) {
+	var rec recordedBatches
+	authEvents = startAuthEventQueue(authEventQueueConfig{size: 16, batchSize: 16, flushInterval: time.Hour}, rec.write)
+	defer connACLs.Reset()
+	defer authSessions.Reset()
+
+	const session = uintptr(1)
+	info := pluginutil.ClientInfo{Username: "ops", ClientID: "c1"}
+	var calls int
+	run := func(out authOutcome) int {
+		return runAuthChain([]authenticator{stubAuthenticator{name: "stub", out: out, calls: &calls}}, session, info, "pwd", time.Now())
+	}
+
+	super := authOutcome{decision: authAllow, reason: authReasonOK, attrs: accountAttrs{acl: connACL{superuser: true}}}
+	if code := run(super); code != mosqErrSuccess {
+		t.Fatalf("superuser login code = %d", code)
+	}
+	if acl, ok := connACLs.Get(session); !ok || !acl.superuser {
+		t.Fatalf("superuser connection ACL = %+v, %v", acl, ok)
+	}
+	if code := run(authOutcome{decision: authAllow, reason: authReasonOK}); code != mosqErrSuccess {
+		t.Fatalf("regular login code = %d", code)
+	}
+	if _, ok := connACLs.Get(session); ok {
+		t.Fatal("re-authentication as regular account should drop superuser ACL")
+	}
+	if code := run(authOutcome{decision: authDeny, reason: authReasonInvalidPassword, attrs: accountAttrs{acl: connACL{superuser: true}}}); code != mosqErrAuth {
+		t.Fatalf("denied login code = %d", code)
+	}
+
+	stopAuthEventQueue()
+	var flags []bool
+	for _, b := range rec.batches {
+		for _, ev := range b {
+			flags = append(flags, ev.superuser)
+		}
+	}
+	if want := []bool{true, false, false}; !reflect.DeepEqual(flags, want) {
+		t.Fatalf("event superuser flags = %v, want %v", flags, want)
+	}
+	if args := authEventArgs(authEvent{superuser: true}); len(args) != authEventQueryMaxParams || args[7] != true {
+		t.Fatalf("authEventArgs = %v", args)
+	}
+}
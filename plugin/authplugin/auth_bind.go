@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// clientid_match 列的取值；为空时按 exact 处理。
+const (
+	clientIDMatchExact  = "exact"
+	clientIDMatchPrefix = "prefix"
+	clientIDMatchRegex  = "regex"
+)
+
+// clientIDPatterns 缓存已编译的 clientid 正则，键为账户行中的原始模式。
+var clientIDPatterns sync.Map
+
+// clientIDBound 判断连接的 clientid 是否满足账户绑定：
+// 账户未绑定时仅在 enforce=false 下放行；已绑定时按 clientid_match 精确/前缀/正则匹配。
+func clientIDBound(acct authAccount, clientID string, enforce bool) bool {
+	if acct.clientID == "" {
+		return !enforce
+	}
+	switch strings.ToLower(strings.TrimSpace(acct.clientIDMatch)) {
+	case "", clientIDMatchExact:
+		return clientID == acct.clientID
+	case clientIDMatchPrefix:
+		return strings.HasPrefix(clientID, acct.clientID)
+	case clientIDMatchRegex:
+		re, err := compileClientIDPattern(acct.clientID)
+		if err != nil {
+			log(mosqLogWarning, "auth-plugin: invalid clientid pattern", map[string]any{"pattern": acct.clientID, "error": err.Error()})
+			return false
+		}
+		return re.MatchString(clientID)
+	default:
+		log(mosqLogWarning, "auth-plugin: unknown clientid_match", map[string]any{"clientid_match": acct.clientIDMatch})
+		return false
+	}
+}
+
+// compileClientIDPattern 编译并缓存正则；模式整体锚定，需完整匹配 clientid。
+func compileClientIDPattern(pattern string) (*regexp.Regexp, error) {
+	if v, ok := clientIDPatterns.Load(pattern); ok {
+		return v.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+	clientIDPatterns.Store(pattern, re)
+	return re, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestClientIDBound(t *testing.T) {
+	cases := []struct {
+		name     string
+		acct     authAccount
+		clientID string
+		enforce  bool
+		want     bool
+	}{
+		{"unbound lenient", authAccount{}, "dev-1", false, true},
+		{"unbound enforced", authAccount{}, "dev-1", true, false},
+		{"exact match", authAccount{clientID: "dev-1"}, "dev-1", true, true},
+		{"exact mismatch", authAccount{clientID: "dev-1"}, "dev-2", false, false},
+		{"explicit exact", authAccount{clientID: "dev-1", clientIDMatch: "EXACT"}, "dev-1", true, true},
+		{"prefix match", authAccount{clientID: "dev-", clientIDMatch: "prefix"}, "dev-42", true, true},
+		{"prefix mismatch", authAccount{clientID: "dev-", clientIDMatch: "prefix"}, "sensor-1", true, false},
+		{"regex match", authAccount{clientID: `dev-[0-9]+`, clientIDMatch: "regex"}, "dev-42", true, true},
+		{"regex anchored", authAccount{clientID: `dev-[0-9]+`, clientIDMatch: "regex"}, "xdev-42y", true, false},
+		{"regex invalid", authAccount{clientID: `dev-(`, clientIDMatch: "regex"}, "dev-(", true, false},
+		{"unknown mode", authAccount{clientID: "dev-1", clientIDMatch: "glob"}, "dev-1", true, false},
+	}
+	for _, c := range cases {
+		if got := clientIDBound(c.acct, c.clientID, c.enforce); got != c.want {
+			t.Fatalf("%s: clientIDBound = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPickAccountRow(t *testing.T) {
+	unbound := authAccount{passwordHash: "null-row"}
+	prefix := authAccount{passwordHash: "prefix-row", clientID: "sensor-", clientIDMatch: clientIDMatchPrefix}
+	other := authAccount{passwordHash: "other-row", clientID: "gateway-1"}
+
+	// 查询把未绑定的行排在 prefix 行之前，匹配的 prefix 行仍应优先。
+	if acct, ok := pickAccountRow([]authAccount{unbound, prefix}, "sensor-42"); !ok || acct.passwordHash != "prefix-row" || !clientIDBound(acct, "sensor-42", true) {
+		t.Fatalf("matching prefix row = %+v, %v", acct, ok)
+	}
+	if acct, _ := pickAccountRow([]authAccount{unbound, prefix}, "other"); acct.passwordHash != "null-row" {
+		t.Fatalf("non-matching clientid should fall back to the first row, got %+v", acct)
+	}
+	if acct, _ := pickAccountRow([]authAccount{other}, "sensor-42"); acct.passwordHash != "other-row" || clientIDBound(acct, "sensor-42", false) {
+		t.Fatalf("only mismatched rows should yield a mismatch, got %+v", acct)
+	}
+	if _, ok := pickAccountRow(nil, "sensor-42"); ok {
+		t.Fatal("no rows should be not found")
+	}
+}
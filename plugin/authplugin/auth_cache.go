@@ -0,0 +1,306 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+const (
+	defaultAuthCachePositiveTTL  = 60 * time.Second
+	defaultAuthCacheNegativeTTL  = 5 * time.Second
+	defaultAuthCacheNotifyChan   = "mqtt_accounts_changed"
+	authCacheListenMaxBackoff    = 30 * time.Second
+	authCacheStatsLogSampleEvery = uint64(1024)
+)
+
+// authCacheKey 以 HMAC 摘要代替明文密码作为缓存键，进程内随机密钥避免摘要被离线比对。
+type authCacheKey struct {
+	username string
+	clientID string
+	digest   [sha256.Size]byte
+}
+
+type authCacheEntry struct {
+	key     authCacheKey
+	allow   bool
+	reason  string
+	attrs   accountAttrs
+	expires time.Time
+}
+
+// authCache 是按 LRU 淘汰的认证结果缓存，位于 dbAuth 之前。
+type authCache struct {
+	mu      sync.Mutex
+	entries map[authCacheKey]*list.Element
+	lru     *list.List
+	// gen 在每次失效时递增；查询开始后发生过失效的结果不再写入，避免回填旧数据。
+	gen uint64
+
+	maxEntries  int
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	secret      []byte
+
+	hits   uint64
+	misses uint64
+}
+
+func newAuthCache(maxEntries int, positiveTTL, negativeTTL time.Duration) *authCache {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return &authCache{
+		entries:     map[authCacheKey]*list.Element{},
+		lru:         list.New(),
+		maxEntries:  maxEntries,
+		positiveTTL: positiveTTL,
+		negativeTTL: negativeTTL,
+		secret:      secret,
+	}
+}
+
+// Key 计算 (username, clientid, password) 对应的缓存键。
+func (c *authCache) Key(username, clientID, password string) authCacheKey {
+	m := hmac.New(sha256.New, c.secret)
+	m.Write([]byte(password))
+	k := authCacheKey{username: username, clientID: clientID}
+	copy(k.digest[:], m.Sum(nil))
+	return k
+}
+
+// Get 返回未过期的缓存结果，并累计命中/未命中计数。
+func (c *authCache) Get(key authCacheKey, now time.Time) (allow bool, reason string, attrs accountAttrs, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, found := c.entries[key]
+	if !found {
+		atomic.AddUint64(&c.misses, 1)
+		return false, "", accountAttrs{}, false
+	}
+	e := el.Value.(*authCacheEntry)
+	if !now.Before(e.expires) {
+		c.removeLocked(el)
+		atomic.AddUint64(&c.misses, 1)
+		return false, "", accountAttrs{}, false
+	}
+	c.lru.MoveToFront(el)
+	atomic.AddUint64(&c.hits, 1)
+	return e.allow, e.reason, e.attrs, true
+}
+
+// Generation 返回当前失效代数，调用方在查库前读取并传给 Put。
+func (c *authCache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// Put 写入认证结果；TTL 为 0 的结果类型不缓存，gen 过期时丢弃。
+// attrs 随结果一起缓存，有效期等检查在命中后按当前时间重新计算。
+func (c *authCache) Put(key authCacheKey, allow bool, reason string, attrs accountAttrs, gen uint64, now time.Time) {
+	ttl := c.negativeTTL
+	if allow {
+		ttl = c.positiveTTL
+	}
+	// 重新哈希只需触发一次，命中缓存时按普通成功处理。
+	if reason == authReasonOKRehash {
+		reason = authReasonOK
+	}
+	if ttl <= 0 || c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if el, found := c.entries[key]; found {
+		e := el.Value.(*authCacheEntry)
+		e.allow, e.reason, e.attrs, e.expires = allow, reason, attrs, now.Add(ttl)
+		c.lru.MoveToFront(el)
+		return
+	}
+	for c.lru.Len() >= c.maxEntries {
+		c.removeLocked(c.lru.Back())
+	}
+	c.entries[key] = c.lru.PushFront(&authCacheEntry{key: key, allow: allow, reason: reason, attrs: attrs, expires: now.Add(ttl)})
+}
+
+// InvalidateUser 删除指定用户名的全部缓存项。
+func (c *authCache) InvalidateUser(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*authCacheEntry).key.username == username {
+			c.removeLocked(el)
+		}
+		el = next
+	}
+}
+
+// Purge 清空缓存。
+func (c *authCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.entries = map[authCacheKey]*list.Element{}
+	c.lru.Init()
+}
+
+// Stats 返回命中、未命中次数与当前条目数。
+func (c *authCache) Stats() (hits, misses uint64, size int) {
+	c.mu.Lock()
+	size = c.lru.Len()
+	c.mu.Unlock()
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses), size
+}
+
+func (c *authCache) removeLocked(el *list.Element) {
+	delete(c.entries, el.Value.(*authCacheEntry).key)
+	c.lru.Remove(el)
+}
+
+// cacheAuthenticator 查询凭据缓存；缓存只保存 postgres 后端的结果，应排在 postgres 之前。
+type cacheAuthenticator struct {
+	cache *authCache
+}
+
+func (cacheAuthenticator) Name() string { return authBackendCache }
+
+func (a cacheAuthenticator) Authenticate(req *authRequest) authOutcome {
+	if req.info.Username == "" || req.password == "" {
+		return authOutcome{decision: authNext}
+	}
+	key := a.cache.Key(req.info.Username, req.info.ClientID, req.password)
+	if allow, reason, attrs, ok := a.cache.Get(key, req.now); ok {
+		logAuthCacheStats(a.cache)
+		return dbOutcome(allow, reason, attrs)
+	}
+	req.cache, req.cacheKey, req.cacheGen = a.cache, key, a.cache.Generation()
+	return authOutcome{decision: authNext}
+}
+
+func logAuthCacheStats(c *authCache) {
+	if !pluginutil.ShouldSample(&authCacheStatsCounter, authCacheStatsLogSampleEvery) {
+		return
+	}
+	hits, misses, size := c.Stats()
+	log(mosqLogInfo, "auth-plugin: auth cache stats", map[string]any{"hits": hits, "misses": misses, "size": size})
+}
+
+// authCacheListener 通过 LISTEN/NOTIFY 接收账户变更并失效缓存。
+type authCacheListener struct {
+	cancel context.CancelFunc
+	doneCh chan struct{}
+}
+
+// startAuthCacheListener 启动后台监听协程；NOTIFY 负载为用户名时只失效该用户，为空时清空缓存。
+func startAuthCacheListener(channel string, c *authCache) *authCacheListener {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &authCacheListener{cancel: cancel, doneCh: make(chan struct{})}
+	go l.run(ctx, channel, c)
+	return l
+}
+
+func (l *authCacheListener) run(ctx context.Context, channel string, c *authCache) {
+	defer close(l.doneCh)
+	backoff := time.Second
+	for {
+		err := listenAccountChanges(ctx, channel, c)
+		if ctx.Err() != nil {
+			return
+		}
+		// 监听中断期间可能漏掉通知，清空缓存以免使用过期结果。
+		c.Purge()
+		log(mosqLogWarning, "auth-plugin: auth cache listener interrupted", map[string]any{"channel": channel, "error": err, "retry_ms": int(backoff / time.Millisecond)})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > authCacheListenMaxBackoff {
+			backoff = authCacheListenMaxBackoff
+		}
+	}
+}
+
+func listenAccountChanges(ctx context.Context, channel string, c *authCache) error {
+	ensureCtx, cancel := ctx, func() {}
+	if timeout > 0 {
+		ensureCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	// NOTIFY 只在主库上投递，LISTEN 必须连主库。
+	p, err := poolHolder.Ensure(ensureCtx, pluginutil.PGPrimary)
+	if err != nil {
+		cancel()
+		return err
+	}
+	pc, err := p.Acquire(ensureCtx)
+	cancel()
+	if err != nil {
+		poolHolder.Report(p, err)
+		return err
+	}
+	// 监听连接长期占用，脱离连接池管理，退出时直接关闭。
+	conn := pc.Hijack()
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize())
+	poolHolder.Report(p, err)
+	if err != nil {
+		return err
+	}
+	// 建立监听前的变更无法感知，重新开始时清空一次。
+	c.Purge()
+	log(mosqLogInfo, "auth-plugin: auth cache listening", map[string]any{"channel": channel})
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			// 插件退出取消监听不是数据库故障。
+			if ctx.Err() == nil {
+				poolHolder.Report(p, err)
+			}
+			return err
+		}
+		if n.Payload == "" {
+			c.Purge()
+		} else {
+			c.InvalidateUser(n.Payload)
+			// 账户变更后旧快照可能已不正确（改密码、禁用），等下次成功认证再记录。
+			if s := lastGood; s != nil {
+				s.InvalidateUser(n.Payload)
+			}
+		}
+	}
+}
+
+// stopAuthCache 停止监听并输出缓存统计；插件重载与退出时调用。
+func stopAuthCache() {
+	if credentialCacheListen != nil {
+		credentialCacheListen.Stop()
+		credentialCacheListen = nil
+	}
+	if credentialCache != nil {
+		hits, misses, size := credentialCache.Stats()
+		log(mosqLogInfo, "auth-plugin: auth cache stats", map[string]any{"hits": hits, "misses": misses, "size": size})
+		credentialCache = nil
+	}
+}
+
+// Stop 停止监听并等待协程退出。
+func (l *authCacheListener) Stop() {
+	l.cancel()
+	<-l.doneCh
+}
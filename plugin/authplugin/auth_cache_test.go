@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthCacheHitMissAndExpiry(t *testing.T) {
+	c := newAuthCache(8, time.Minute, time.Second)
+	now := time.Unix(1700000000, 0)
+	key := c.Key("alice", "c1", "pwd")
+
+	if _, _, _, ok := c.Get(key, now); ok {
+		t.Fatal("empty cache should miss")
+	}
+	c.Put(key, true, authReasonOKRehash, accountAttrs{}, c.Generation(), now)
+	allow, reason, _, ok := c.Get(key, now.Add(30*time.Second))
+	if !ok || !allow || reason != authReasonOK {
+		t.Fatalf("cached positive = (%v, %q, %v), want (true, %q, true)", allow, reason, ok, authReasonOK)
+	}
+	if _, _, _, ok := c.Get(key, now.Add(2*time.Minute)); ok {
+		t.Fatal("expired entry should miss")
+	}
+	if hits, misses, size := c.Stats(); hits != 1 || misses != 2 || size != 0 {
+		t.Fatalf("stats = (%d, %d, %d), want (1, 2, 0)", hits, misses, size)
+	}
+}
+
+func TestAuthCacheKeyDependsOnPassword(t *testing.T) {
+	c := newAuthCache(8, time.Minute, time.Second)
+	now := time.Unix(1700000000, 0)
+	c.Put(c.Key("alice", "c1", "pwd"), true, authReasonOK, accountAttrs{}, c.Generation(), now)
+
+	if _, _, _, ok := c.Get(c.Key("alice", "c1", "other"), now); ok {
+		t.Fatal("different password should miss")
+	}
+	if _, _, _, ok := c.Get(c.Key("alice", "c2", "pwd"), now); ok {
+		t.Fatal("different client id should miss")
+	}
+}
+
+func TestAuthCacheNegativeTTLDisabled(t *testing.T) {
+	c := newAuthCache(8, time.Minute, 0)
+	now := time.Unix(1700000000, 0)
+	key := c.Key("alice", "c1", "bad")
+	c.Put(key, false, authReasonInvalidPassword, accountAttrs{}, c.Generation(), now)
+	if _, _, _, ok := c.Get(key, now); ok {
+		t.Fatal("negative result should not be cached when negative TTL is 0")
+	}
+}
+
+func TestAuthCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newAuthCache(2, time.Minute, time.Minute)
+	now := time.Unix(1700000000, 0)
+	a, b, d := c.Key("a", "", "p"), c.Key("b", "", "p"), c.Key("d", "", "p")
+	c.Put(a, true, authReasonOK, accountAttrs{}, c.Generation(), now)
+	c.Put(b, true, authReasonOK, accountAttrs{}, c.Generation(), now)
+	c.Get(a, now)
+	c.Put(d, true, authReasonOK, accountAttrs{}, c.Generation(), now)
+
+	if _, _, _, ok := c.Get(b, now); ok {
+		t.Fatal("least recently used entry should be evicted")
+	}
+	if _, _, _, ok := c.Get(a, now); !ok {
+		t.Fatal("recently used entry should be kept")
+	}
+}
+
+func TestAuthCacheInvalidation(t *testing.T) {
+	c := newAuthCache(8, time.Minute, time.Minute)
+	now := time.Unix(1700000000, 0)
+	alice, bob := c.Key("alice", "c1", "p"), c.Key("bob", "c2", "p")
+	c.Put(alice, true, authReasonOK, accountAttrs{}, c.Generation(), now)
+	c.Put(bob, true, authReasonOK, accountAttrs{}, c.Generation(), now)
+
+	c.InvalidateUser("alice")
+	if _, _, _, ok := c.Get(alice, now); ok {
+		t.Fatal("invalidated user should miss")
+	}
+	if _, _, _, ok := c.Get(bob, now); !ok {
+		t.Fatal("other users should stay cached")
+	}
+
+	c.Purge()
+	if _, _, _, ok := c.Get(bob, now); ok {
+		t.Fatal("purge should clear all entries")
+	}
+}
+
+func TestAuthCacheDropsStaleGeneration(t *testing.T) {
+	c := newAuthCache(8, time.Minute, time.Minute)
+	now := time.Unix(1700000000, 0)
+	key := c.Key("alice", "c1", "p")
+	gen := c.Generation()
+	// 查库期间收到失效通知，旧结果不应回填。
+	c.InvalidateUser("alice")
+	c.Put(key, true, authReasonOK, accountAttrs{}, gen, now)
+	if _, _, _, ok := c.Get(key, now); ok {
+		t.Fatal("result from a stale generation should not be cached")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// certAuthResult 为证书认证结果；username 为证书映射出的账户名，供 CONNECT 未带用户名时回写。
+type certAuthResult struct {
+	code     int
+	username string
+}
+
+// certAccountReason 检查证书指纹的吊销与绑定，返回拒绝原因；空串表示放行。吊销列表无法解析时视为已吊销。
+// fingerprint 为已归一化的 SHA-256 指纹。
+func certAccountReason(acct authAccount, fingerprint string) string {
+	if acct.revokedCertsInvalid {
+		return authReasonCertRevoked
+	}
+	for _, revoked := range acct.revokedCertFingerprints {
+		if pluginutil.NormalizeFingerprint(revoked) == fingerprint {
+			return authReasonCertRevoked
+		}
+	}
+	if acct.certFingerprint != "" && pluginutil.NormalizeFingerprint(acct.certFingerprint) != fingerprint {
+		return authReasonCertFingerprintMismatch
+	}
+	return ""
+}
+
+// columnStrings 解析 text[] 或逗号分隔的文本列，NULL 或空列表返回 nil。
+func columnStrings(v any) ([]string, error) {
+	var out []string
+	add := func(item any) error {
+		switch x := item.(type) {
+		case nil:
+		case string:
+			for _, s := range strings.Split(x, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					out = append(out, s)
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported element %T", item)
+		}
+		return nil
+	}
+	switch x := v.(type) {
+	case []any:
+		for _, item := range x {
+			if err := add(item); err != nil {
+				return nil, err
+			}
+		}
+	case []string:
+		for _, item := range x {
+			if err := add(item); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if err := add(v); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// runCertAuth 以 TLS 客户端证书的 CN/SAN 作为账户名认证，不校验密码。
+// 证书链已由 Mosquitto 监听器（require_certificate）校验，这里只负责身份映射、指纹绑定与吊销。
+func runCertAuth(session uintptr, info pluginutil.ClientInfo, cert *x509.Certificate) certAuthResult {
+	identity := pluginutil.CertIdentity(cert, certIdentitySources)
+	if identity == "" {
+		recordAuthResult(info, false, authReasonCertNoIdentity)
+		return certAuthResult{code: mosqErrAuth}
+	}
+	// CONNECT 携带用户名时必须与证书身份一致，避免借他人证书登录其它账户。
+	if info.Username != "" && info.Username != identity {
+		recordAuthResult(info, false, authReasonCertIdentityMismatch)
+		return certAuthResult{code: mosqErrAuth}
+	}
+	info.Username = identity
+	if shouldDefer(info) {
+		return certAuthResult{code: mosqErrDefer}
+	}
+	if r := preAuthReason(info); r != "" {
+		recordAuthResult(info, false, r)
+		return certAuthResult{code: mosqErrAuth}
+	}
+
+	now := time.Now()
+	acct, found, err := lookupAccount(identity, info.ClientID)
+	if err != nil {
+		log(mosqLogWarning, "auth-plugin auth error", map[string]any{"error": err.Error(), "method": "certificate"})
+		if failOpen {
+			log(mosqLogInfo, "auth-plugin: fail_open allow auth", map[string]any{"reason": authReasonDBError})
+			recordAuthResult(info, true, authReasonDBErrorFailOpen)
+			return certAuthResult{code: mosqErrSuccess, username: identity}
+		}
+		recordAuthResult(info, false, authReasonDBError)
+		return certAuthResult{code: mosqErrAuth}
+	}
+
+	reason := ""
+	switch {
+	case !found:
+		reason = authReasonUserNotFound
+	case !acct.enabled:
+		reason = authReasonUserDisabled
+	case !clientIDBound(acct, info.ClientID, enforceBind):
+		reason = authReasonClientIDMismatch
+	default:
+		if reason = certAccountReason(acct, pluginutil.CertFingerprint(cert)); reason == "" {
+			reason = checkAccountAttrs(acct.accountAttrs, info, now)
+		}
+		if reason == "" {
+			reason = admitConnection(session, info, acct.accountAttrs)
+		}
+	}
+	if reason != "" {
+		recordAuthResult(info, false, reason)
+		return certAuthResult{code: mosqErrAuth}
+	}
+	if session != 0 {
+		// 超级用户登记连接级 ACL 以跳过规则检查，其余账户清除旧记录。
+		connACLs.Put(session, connACL{superuser: acct.acl.superuser})
+		authSessions.Track(session, authSession{clientID: info.ClientID, username: identity, validUntil: acct.validUntil})
+	}
+	recordAuthOutcome(info, true, authReasonCertOK, acct.acl.superuser)
+	return certAuthResult{code: mosqErrSuccess, username: identity}
+}
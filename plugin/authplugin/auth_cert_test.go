@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCertAccountReason(t *testing.T) {
+	fp := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	other := "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"
+
+	cases := []struct {
+		name string
+		acct authAccount
+		want string
+	}{
+		{"no pin", authAccount{}, ""},
+		{"pinned", authAccount{certFingerprint: "SHA256:" + fp}, ""},
+		{"pin mismatch", authAccount{certFingerprint: other}, authReasonCertFingerprintMismatch},
+		{"revoked", authAccount{revokedCertFingerprints: []string{other, fp}}, authReasonCertRevoked},
+		{"revoked wins over pin", authAccount{certFingerprint: fp, revokedCertFingerprints: []string{fp}}, authReasonCertRevoked},
+		{"invalid revocation list", authAccount{certFingerprint: fp, revokedCertsInvalid: true}, authReasonCertRevoked},
+	}
+	for _, tc := range cases {
+		if got := certAccountReason(tc.acct, fp); got != tc.want {
+			t.Errorf("%s: reason = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestColumnStrings(t *testing.T) {
+	cases := []struct {
+		in   any
+		want []string
+	}{
+		{nil, nil},
+		{"", nil},
+		{"a, b,,c", []string{"a", "b", "c"}},
+		{[]any{"a", nil, "b"}, []string{"a", "b"}},
+		{[]string{"a"}, []string{"a"}},
+	}
+	for _, tc := range cases {
+		got, err := columnStrings(tc.in)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("columnStrings(%v) = %v, %v; want %v", tc.in, got, err, tc.want)
+		}
+	}
+	if _, err := columnStrings(42); err == nil {
+		t.Errorf("columnStrings(42) should fail")
+	}
+}
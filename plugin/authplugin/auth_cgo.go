@@ -1,24 +1,33 @@
 package main
 
 /*
-#cgo darwin pkg-config: libmosquitto libcjson
+#cgo darwin pkg-config: libmosquitto libcjson libcrypto
 #cgo darwin LDFLAGS: -Wl,-undefined,dynamic_lookup
-#cgo linux  pkg-config: libmosquitto libcjson
+#cgo linux  pkg-config: libmosquitto libcjson libcrypto
 #include <stdlib.h>
 #include <mosquitto.h>
 
 typedef int (*mosq_event_cb)(int event, void *event_data, void *userdata);
 
 int basic_auth_cb_c(int event, void *event_data, void *userdata);
+int acl_check_cb_c(int event, void *event_data, void *userdata);
+int tick_cb_c(int event, void *event_data, void *userdata);
+int disconnect_cb_c(int event, void *event_data, void *userdata);
+int ext_auth_start_cb_c(int event, void *event_data, void *userdata);
+int ext_auth_continue_cb_c(int event, void *event_data, void *userdata);
 
 int register_event_callback(mosquitto_plugin_id_t *id, int event, mosq_event_cb cb);
 int unregister_event_callback(mosquitto_plugin_id_t *id, int event, mosq_event_cb cb);
 void go_mosq_log(int level, const char* msg);
+int go_mosq_client_cert_der(const struct mosquitto *client, unsigned char **der);
+void go_mosq_free_der(unsigned char *der);
 */
 import "C"
 
 import (
 	"context"
+	"crypto/x509"
+	"net/url"
 	"os"
 	"runtime/debug"
 	"strings"
@@ -33,12 +42,20 @@ import (
 var pid *C.mosquitto_plugin_id_t
 
 const (
-	mosqLogInfo    = int(C.MOSQ_LOG_INFO)
-	mosqLogWarning = int(C.MOSQ_LOG_WARNING)
-	mosqLogError   = int(C.MOSQ_LOG_ERR)
-	mosqErrDefer   = int(C.MOSQ_ERR_PLUGIN_DEFER)
-	mosqErrAuth    = int(C.MOSQ_ERR_AUTH)
-	mosqErrSuccess = int(C.MOSQ_ERR_SUCCESS)
+	mosqLogInfo      = int(C.MOSQ_LOG_INFO)
+	mosqLogWarning   = int(C.MOSQ_LOG_WARNING)
+	mosqLogError     = int(C.MOSQ_LOG_ERR)
+	mosqErrDefer     = int(C.MOSQ_ERR_PLUGIN_DEFER)
+	mosqErrAuth      = int(C.MOSQ_ERR_AUTH)
+	mosqErrACLDenied = int(C.MOSQ_ERR_ACL_DENIED)
+	mosqErrSuccess   = int(C.MOSQ_ERR_SUCCESS)
+	// mosqErrAuthContinue 表示增强认证需要继续交换 AUTH 报文。
+	mosqErrAuthContinue = int(C.MOSQ_ERR_AUTH_CONTINUE)
+
+	mosqACLRead        = int(C.MOSQ_ACL_READ)
+	mosqACLWrite       = int(C.MOSQ_ACL_WRITE)
+	mosqACLSubscribe   = int(C.MOSQ_ACL_SUBSCRIBE)
+	mosqACLUnsubscribe = int(C.MOSQ_ACL_UNSUBSCRIBE)
 )
 
 func log(level int, msg string, fields map[string]any) {
@@ -72,9 +89,45 @@ func clientInfoFromBasicAuth(ed *C.struct_mosquitto_evt_basic_auth) pluginutil.C
 	}
 	info.Peer = cstr(C.mosquitto_client_address(ed.client))
 	info.Protocol = pluginutil.ProtocolString(int(C.mosquitto_client_protocol_version(ed.client)))
+	info.ListenerPort = int(C.mosquitto_client_port(ed.client))
+	info.Transport = pluginutil.TransportString(int(C.mosquitto_client_protocol(ed.client)))
 	return info
 }
 
+// clientInfoFromClient 提取已连接客户端的标识信息（ACL 等非认证事件使用）。
+func clientInfoFromClient(client *C.struct_mosquitto) pluginutil.ClientInfo {
+	info := pluginutil.ClientInfo{}
+	if client == nil {
+		return info
+	}
+	info.ClientID = cstr(C.mosquitto_client_id(client))
+	info.Username = cstr(C.mosquitto_client_username(client))
+	info.Peer = cstr(C.mosquitto_client_address(client))
+	info.Protocol = pluginutil.ProtocolString(int(C.mosquitto_client_protocol_version(client)))
+	info.ListenerPort = int(C.mosquitto_client_port(client))
+	info.Transport = pluginutil.TransportString(int(C.mosquitto_client_protocol(client)))
+	return info
+}
+
+// clientCertificate 读取客户端 TLS 证书；未出示证书或解析失败时返回 nil。
+func clientCertificate(client *C.struct_mosquitto) *x509.Certificate {
+	if client == nil {
+		return nil
+	}
+	var der *C.uchar
+	n := C.go_mosq_client_cert_der(client, &der)
+	if n <= 0 || der == nil {
+		return nil
+	}
+	defer C.go_mosq_free_der(der)
+	cert, err := x509.ParseCertificate(C.GoBytes(unsafe.Pointer(der), n))
+	if err != nil {
+		log(mosqLogWarning, "auth-plugin: parse client certificate failed", map[string]any{"error": err.Error()})
+		return nil
+	}
+	return cert
+}
+
 // go_mosq_plugin_version 选择最高支持的插件 API 版本。
 //
 //export go_mosq_plugin_version
@@ -102,8 +155,59 @@ func go_mosq_plugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
 
 	pid = id
 	pgDSN = ""
+	pgReplicaDSNs = nil
+	pgHealthCheckInterval = defaultPGHealthCheckInterval
+	pgBreakerThreshold = 0
+	pgBreakerOpen = defaultPGBreakerOpen
 	timeout = defaultTimeout
 	failOpen = false
+	aclEnabled = false
+	enforceBind = false
+	deferRules = defaultDeferRules
+	deferRecord = false
+	clientIDFormat = formatPolicy{}
+	usernameFormat = formatPolicy{}
+	allowedProtocols = nil
+	allowedListeners = nil
+	tenantCfg = defaultTenantConfig()
+	scramEnabled = false
+	scramExchanges.Reset()
+	jwtCfg = defaultJWTConfig()
+	jwtKeys = nil
+	connACLs.Reset()
+	stopHTTPAuth()
+	httpAuthCfg = defaultHTTPAuthConfig()
+	authFilePath = ""
+	authFile = nil
+	authBackendNames = nil
+	authBackends = nil
+	certAuthEnabled = false
+	certIdentitySources = []string{pluginutil.CertIdentityCN}
+	rehashOnLogin = false
+	passwordHashAlgo = pluginutil.HashAlgoBcrypt
+	authCacheSize = 0
+	authCachePositiveTTL = defaultAuthCachePositiveTTL
+	authCacheNegativeTTL = defaultAuthCacheNegativeTTL
+	authCacheNotifyChannel = defaultAuthCacheNotifyChan
+	authCacheStatsCounter = 0
+	stopAuthCache()
+	stopLastGood()
+	lastGoodCfg = lastGoodConfig{maxAge: defaultLastGoodMaxAge, saveInterval: defaultLastGoodSaveInterval}
+	lockoutCfg = lockoutPolicy{window: defaultLockoutWindow, duration: defaultLockoutDuration, max: defaultLockoutMax}
+	lockoutPersist = false
+	authLockouts = nil
+	authSessions.Reset()
+	authConns.Reset()
+	maxConnectionsPolicy = connLimitReject
+	authQueries.Reset()
+	stopAuthEventQueue()
+	authEventCfg = authEventQueueConfig{
+		batchSize:      defaultAuthEventBatchSize,
+		flushInterval:  defaultAuthEventFlushInterval,
+		enqueueTimeout: defaultAuthEventEnqueueTimeout,
+	}
+	authEventDropCounter = 0
+	aclWarnCounter = 0
 	// 重载时先回收旧池，避免沿用过期配置。
 	poolHolder.Close()
 
@@ -115,6 +219,29 @@ func go_mosq_plugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
 		switch key {
 		case "pg_dsn":
 			pgDSN = value
+		case "pg_replica_dsn":
+			// 可重复配置，按出现顺序排在 pg_dsn 之后。
+			if dsn := strings.TrimSpace(value); dsn != "" {
+				pgReplicaDSNs = append(pgReplicaDSNs, dsn)
+			}
+		case "pg_health_check_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				pgHealthCheckInterval = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid pg_health_check_ms", map[string]any{"value": value, "pg_health_check_ms": int(pgHealthCheckInterval / time.Millisecond)})
+			}
+		case "pg_breaker_threshold":
+			if n, ok := parseNonNegativeInt(value); ok {
+				pgBreakerThreshold = n
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid pg_breaker_threshold", map[string]any{"value": value, "pg_breaker_threshold": pgBreakerThreshold})
+			}
+		case "pg_breaker_open_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				pgBreakerOpen = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid pg_breaker_open_ms", map[string]any{"value": value, "pg_breaker_open_ms": int(pgBreakerOpen / time.Millisecond)})
+			}
 		case "timeout_ms":
 			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
 				timeout = dur
@@ -127,6 +254,307 @@ func go_mosq_plugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
 			} else {
 				log(mosqLogWarning, "auth-plugin: invalid fail_open", map[string]any{"value": value, "fail_open": failOpen})
 			}
+		case "acl_enabled":
+			if parsed, ok := parseBoolOption(value); ok {
+				aclEnabled = parsed
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid acl_enabled", map[string]any{"value": value, "acl_enabled": aclEnabled})
+			}
+		case "defer_rules":
+			if rules, err := parseDeferRules(value); err == nil {
+				deferRules = rules
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid defer_rules", map[string]any{"value": value, "error": err.Error(), "defer_rules": deferRulesString(deferRules)})
+			}
+		case "defer_record":
+			if parsed, ok := parseBoolOption(value); ok {
+				deferRecord = parsed
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid defer_record", map[string]any{"value": value, "defer_record": deferRecord})
+			}
+		case "clientid_pattern":
+			if !clientIDFormat.setPattern(strings.TrimSpace(value)) {
+				log(mosqLogWarning, "auth-plugin: invalid clientid_pattern", map[string]any{"value": value, "clientid_pattern": clientIDFormat.raw})
+			}
+		case "clientid_max_length":
+			if n, ok := parseNonNegativeInt(value); ok {
+				clientIDFormat.maxLength = n
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid clientid_max_length", map[string]any{"value": value, "clientid_max_length": clientIDFormat.maxLength})
+			}
+		case "clientid_forbidden_chars":
+			clientIDFormat.forbidden = value
+		case "username_pattern":
+			if !usernameFormat.setPattern(strings.TrimSpace(value)) {
+				log(mosqLogWarning, "auth-plugin: invalid username_pattern", map[string]any{"value": value, "username_pattern": usernameFormat.raw})
+			}
+		case "username_max_length":
+			if n, ok := parseNonNegativeInt(value); ok {
+				usernameFormat.maxLength = n
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid username_max_length", map[string]any{"value": value, "username_max_length": usernameFormat.maxLength})
+			}
+		case "username_forbidden_chars":
+			usernameFormat.forbidden = value
+		case "allowed_protocols":
+			if protocols, err := parseProtocols(splitList(value)); err == nil {
+				allowedProtocols = protocols
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid allowed_protocols", map[string]any{"value": value, "error": err.Error(), "allowed_protocols": strings.Join(allowedProtocols, ",")})
+			}
+		case "allowed_listeners":
+			if listeners, err := parseListeners(splitList(value)); err == nil {
+				allowedListeners = listeners
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid allowed_listeners", map[string]any{"value": value, "error": err.Error(), "allowed_listeners": strings.Join(allowedListeners, ",")})
+			}
+		case "tenant_separator":
+			tenantCfg.separator = value
+		case "tenant_mode":
+			if mode, ok := parseTenantMode(value); ok {
+				tenantCfg.mode = mode
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid tenant_mode", map[string]any{"value": value, "tenant_mode": tenantCfg.mode})
+			}
+		case "tenant_topic_prefix":
+			if prefix, err := parseTenantTopicPrefix(value); err == nil {
+				tenantCfg.topicPrefix = prefix
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid tenant_topic_prefix", map[string]any{"value": value, "error": err.Error(), "tenant_topic_prefix": tenantCfg.topicPrefix})
+			}
+		case "scram_enabled":
+			if parsed, ok := parseBoolOption(value); ok {
+				scramEnabled = parsed
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid scram_enabled", map[string]any{"value": value, "scram_enabled": scramEnabled})
+			}
+		case "auth_backends":
+			if names, ok := parseAuthBackends(value); ok {
+				authBackendNames = names
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid auth_backends", map[string]any{"value": value, "auth_backends": strings.Join(defaultAuthBackends, ",")})
+			}
+		case "auth_file":
+			authFilePath = strings.TrimSpace(value)
+		case "http_auth_url":
+			httpAuthCfg.url = strings.TrimSpace(value)
+		case "http_auth_timeout_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				httpAuthCfg.timeout = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid http_auth_timeout_ms", map[string]any{"value": value})
+			}
+		case "http_auth_max_conns":
+			if n, ok := parseNonNegativeInt(value); ok && n > 0 {
+				httpAuthCfg.maxConns = n
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid http_auth_max_conns", map[string]any{"value": value, "http_auth_max_conns": httpAuthCfg.maxConns})
+			}
+		case "http_auth_cache_size":
+			if n, ok := parseNonNegativeInt(value); ok {
+				httpAuthCfg.cacheSize = n
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid http_auth_cache_size", map[string]any{"value": value, "http_auth_cache_size": httpAuthCfg.cacheSize})
+			}
+		case "http_auth_cache_ttl_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				httpAuthCfg.cacheTTL = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid http_auth_cache_ttl_ms", map[string]any{"value": value, "http_auth_cache_ttl_ms": int(httpAuthCfg.cacheTTL / time.Millisecond)})
+			}
+		case "http_auth_cache_negative_ttl_ms":
+			if n, ok := parseNonNegativeInt(value); ok {
+				httpAuthCfg.cacheNegTTL = time.Duration(n) * time.Millisecond
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid http_auth_cache_negative_ttl_ms", map[string]any{"value": value, "http_auth_cache_negative_ttl_ms": int(httpAuthCfg.cacheNegTTL / time.Millisecond)})
+			}
+		case "cert_auth_enabled":
+			if parsed, ok := parseBoolOption(value); ok {
+				certAuthEnabled = parsed
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid cert_auth_enabled", map[string]any{"value": value, "cert_auth_enabled": certAuthEnabled})
+			}
+		case "cert_identity":
+			if sources, ok := pluginutil.ParseCertIdentitySources(value); ok {
+				certIdentitySources = sources
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid cert_identity", map[string]any{"value": value, "cert_identity": strings.Join(certIdentitySources, ",")})
+			}
+		case "jwt_enabled":
+			if parsed, ok := parseBoolOption(value); ok {
+				jwtCfg.enabled = parsed
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid jwt_enabled", map[string]any{"value": value, "jwt_enabled": jwtCfg.enabled})
+			}
+		case "jwt_hs256_secret":
+			// 可重复配置以支持密钥轮换。
+			if value != "" {
+				jwtCfg.secrets = append(jwtCfg.secrets, value)
+			}
+		case "jwt_public_key_file":
+			if path := strings.TrimSpace(value); path != "" {
+				jwtCfg.publicKeyFiles = append(jwtCfg.publicKeyFiles, path)
+			}
+		case "jwt_jwks_file":
+			if path := strings.TrimSpace(value); path != "" {
+				jwtCfg.jwksFiles = append(jwtCfg.jwksFiles, path)
+			}
+		case "jwt_audience":
+			jwtCfg.audience = strings.TrimSpace(value)
+		case "jwt_issuer":
+			jwtCfg.issuer = strings.TrimSpace(value)
+		case "jwt_identity_claim":
+			if claim := strings.TrimSpace(value); claim != "" {
+				jwtCfg.identityClaim = claim
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid jwt_identity_claim", map[string]any{"value": value, "jwt_identity_claim": jwtCfg.identityClaim})
+			}
+		case "jwt_identity_match":
+			if m, ok := parseJWTMatch(value); ok {
+				jwtCfg.identityMatch = m
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid jwt_identity_match", map[string]any{"value": value, "jwt_identity_match": jwtCfg.identityMatch})
+			}
+		case "jwt_acl_claim":
+			jwtCfg.aclClaim = strings.TrimSpace(value)
+		case "jwt_leeway_ms":
+			if n, ok := parseNonNegativeInt(value); ok {
+				jwtCfg.leeway = time.Duration(n) * time.Millisecond
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid jwt_leeway_ms", map[string]any{"value": value, "jwt_leeway_ms": int(jwtCfg.leeway / time.Millisecond)})
+			}
+		case "enforce_bind":
+			if parsed, ok := parseBoolOption(value); ok {
+				enforceBind = parsed
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid enforce_bind", map[string]any{"value": value, "enforce_bind": enforceBind})
+			}
+		case "rehash_on_login":
+			if parsed, ok := parseBoolOption(value); ok {
+				rehashOnLogin = parsed
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid rehash_on_login", map[string]any{"value": value, "rehash_on_login": rehashOnLogin})
+			}
+		case "password_hash_algo":
+			if algo, ok := pluginutil.ParseHashAlgorithm(value); ok {
+				passwordHashAlgo = algo
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid password_hash_algo", map[string]any{"value": value, "password_hash_algo": passwordHashAlgo})
+			}
+		case "auth_cache_size":
+			if n, ok := parseNonNegativeInt(value); ok {
+				authCacheSize = n
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid auth_cache_size", map[string]any{"value": value, "auth_cache_size": authCacheSize})
+			}
+		case "auth_cache_ttl_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				authCachePositiveTTL = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid auth_cache_ttl_ms", map[string]any{"value": value, "auth_cache_ttl_ms": int(authCachePositiveTTL / time.Millisecond)})
+			}
+		case "auth_cache_negative_ttl_ms":
+			if n, ok := parseNonNegativeInt(value); ok {
+				authCacheNegativeTTL = time.Duration(n) * time.Millisecond
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid auth_cache_negative_ttl_ms", map[string]any{"value": value, "auth_cache_negative_ttl_ms": int(authCacheNegativeTTL / time.Millisecond)})
+			}
+		case "auth_cache_notify_channel":
+			authCacheNotifyChannel = strings.TrimSpace(value)
+		case "last_good_size":
+			if n, ok := parseNonNegativeInt(value); ok {
+				lastGoodCfg.size = n
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid last_good_size", map[string]any{"value": value, "last_good_size": lastGoodCfg.size})
+			}
+		case "last_good_max_age_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				lastGoodCfg.maxAge = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid last_good_max_age_ms", map[string]any{"value": value, "last_good_max_age_ms": int(lastGoodCfg.maxAge / time.Millisecond)})
+			}
+		case "last_good_file":
+			lastGoodCfg.path = strings.TrimSpace(value)
+		case "last_good_save_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				lastGoodCfg.saveInterval = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid last_good_save_ms", map[string]any{"value": value, "last_good_save_ms": int(lastGoodCfg.saveInterval / time.Millisecond)})
+			}
+		case "max_connections_policy":
+			if p, ok := parseConnLimitPolicy(value); ok {
+				maxConnectionsPolicy = p
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid max_connections_policy", map[string]any{"value": value, "max_connections_policy": connLimitPolicyString(maxConnectionsPolicy)})
+			}
+		case "auth_query":
+			if sql := strings.TrimSpace(value); sql != "" {
+				authQueries.SetAccount(sql)
+			}
+		case "auth_event_query":
+			if sql := strings.TrimSpace(value); sql != "" {
+				authQueries.SetEvent(sql)
+			}
+		case "auth_event_queue_size":
+			if n, ok := parseNonNegativeInt(value); ok {
+				authEventCfg.size = n
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid auth_event_queue_size", map[string]any{"value": value, "auth_event_queue_size": authEventCfg.size})
+			}
+		case "auth_event_batch_size":
+			if n, ok := parseNonNegativeInt(value); ok && n > 0 {
+				authEventCfg.batchSize = n
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid auth_event_batch_size", map[string]any{"value": value, "auth_event_batch_size": authEventCfg.batchSize})
+			}
+		case "auth_event_flush_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				authEventCfg.flushInterval = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid auth_event_flush_ms", map[string]any{"value": value, "auth_event_flush_ms": int(authEventCfg.flushInterval / time.Millisecond)})
+			}
+		case "auth_event_fail_mode":
+			if mode, ok := parseAuthEventFailMode(value); ok {
+				authEventCfg.failMode = mode
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid auth_event_fail_mode", map[string]any{"value": value, "fail_mode": authEventFailModeString(authEventCfg.failMode)})
+			}
+		case "auth_event_enqueue_timeout_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				authEventCfg.enqueueTimeout = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid auth_event_enqueue_timeout_ms", map[string]any{"value": value, "enqueue_timeout_ms": int(authEventCfg.enqueueTimeout / time.Millisecond)})
+			}
+		case "lockout_threshold":
+			if n, ok := parseNonNegativeInt(value); ok {
+				lockoutCfg.threshold = n
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid lockout_threshold", map[string]any{"value": value, "lockout_threshold": lockoutCfg.threshold})
+			}
+		case "lockout_window_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				lockoutCfg.window = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid lockout_window_ms", map[string]any{"value": value, "lockout_window_ms": int(lockoutCfg.window / time.Millisecond)})
+			}
+		case "lockout_duration_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				lockoutCfg.duration = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid lockout_duration_ms", map[string]any{"value": value, "lockout_duration_ms": int(lockoutCfg.duration / time.Millisecond)})
+			}
+		case "lockout_max_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				lockoutCfg.max = dur
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid lockout_max_ms", map[string]any{"value": value, "lockout_max_ms": int(lockoutCfg.max / time.Millisecond)})
+			}
+		case "lockout_persist":
+			if parsed, ok := parseBoolOption(value); ok {
+				lockoutPersist = parsed
+			} else {
+				log(mosqLogWarning, "auth-plugin: invalid lockout_persist", map[string]any{"value": value, "lockout_persist": lockoutPersist})
+			}
 		}
 	}
 	if pgDSN == "" {
@@ -137,8 +565,57 @@ func go_mosq_plugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
 		log(mosqLogError, "auth-plugin: invalid pg_dsn", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN), "error": err.Error()})
 		return C.MOSQ_ERR_UNKNOWN
 	}
+	for _, dsn := range pgReplicaDSNs {
+		if _, err := pgxpool.ParseConfig(dsn); err != nil {
+			log(mosqLogError, "auth-plugin: invalid pg_replica_dsn", map[string]any{"pg_replica_dsn": pluginutil.SafeDSN(dsn), "error": err.Error()})
+			return C.MOSQ_ERR_UNKNOWN
+		}
+	}
+	if httpAuthCfg.url != "" {
+		if u, err := url.Parse(httpAuthCfg.url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log(mosqLogError, "auth-plugin: invalid http_auth_url", map[string]any{"http_auth_url": pluginutil.SafeDSN(httpAuthCfg.url)})
+			return C.MOSQ_ERR_UNKNOWN
+		}
+		// 未单独配置时沿用数据库超时，保证两条路径的 fail_open 语义一致。
+		if httpAuthCfg.timeout == 0 {
+			httpAuthCfg.timeout = timeout
+		}
+		httpAuth = newHTTPAuthBackend(httpAuthCfg)
+		log(mosqLogInfo, "auth-plugin: http auth enabled", map[string]any{"http_auth_url": pluginutil.SafeDSN(httpAuthCfg.url), "http_auth_timeout_ms": int(httpAuthCfg.timeout / time.Millisecond),
+			"http_auth_max_conns": httpAuthCfg.maxConns, "http_auth_cache_size": httpAuthCfg.cacheSize})
+	}
+	if jwtCfg.enabled {
+		keys, err := loadJWTKeys(jwtCfg)
+		if err != nil {
+			log(mosqLogError, "auth-plugin: invalid jwt keys", map[string]any{"error": err.Error()})
+			releaseResources()
+			return C.MOSQ_ERR_UNKNOWN
+		}
+		jwtKeys = keys
+		log(mosqLogInfo, "auth-plugin: jwt auth enabled", map[string]any{"keys": keys.Len(), "jwt_audience": jwtCfg.audience, "jwt_issuer": jwtCfg.issuer,
+			"jwt_identity_claim": jwtCfg.identityClaim, "jwt_identity_match": jwtCfg.identityMatch, "jwt_leeway_ms": int(jwtCfg.leeway / time.Millisecond)})
+	}
+	if authFilePath != "" {
+		store, err := loadAuthFile(authFilePath)
+		if err != nil {
+			log(mosqLogError, "auth-plugin: invalid auth_file", map[string]any{"auth_file": authFilePath, "error": err.Error()})
+			releaseResources()
+			return C.MOSQ_ERR_UNKNOWN
+		}
+		authFile = store
+		log(mosqLogInfo, "auth-plugin: auth file loaded", map[string]any{"auth_file": authFilePath, "users": len(store.users)})
+	}
 
-	log(mosqLogInfo, "auth-plugin: initializing", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN), "timeout_ms": int(timeout / time.Millisecond), "fail_open": failOpen})
+	log(mosqLogInfo, "auth-plugin: initializing", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN), "pg_replicas": len(pgReplicaDSNs), "pg_breaker_threshold": pgBreakerThreshold, "pg_breaker_open_ms": int(pgBreakerOpen / time.Millisecond), "timeout_ms": int(timeout / time.Millisecond), "fail_open": failOpen, "acl_enabled": aclEnabled, "enforce_bind": enforceBind,
+		"defer_rules": deferRulesString(deferRules), "defer_record": deferRecord,
+		"clientid_pattern": clientIDFormat.raw, "clientid_max_length": clientIDFormat.maxLength, "clientid_forbidden_chars": clientIDFormat.forbidden,
+		"username_pattern": usernameFormat.raw, "username_max_length": usernameFormat.maxLength, "username_forbidden_chars": usernameFormat.forbidden,
+		"allowed_protocols": strings.Join(allowedProtocols, ","), "allowed_listeners": strings.Join(allowedListeners, ","),
+		"tenant_separator": tenantCfg.separator, "tenant_mode": tenantCfg.mode, "tenant_topic_prefix": tenantCfg.topicPrefix,
+		"scram_enabled": scramEnabled, "cert_auth_enabled": certAuthEnabled, "cert_identity": strings.Join(certIdentitySources, ","), "rehash_on_login": rehashOnLogin, "password_hash_algo": passwordHashAlgo,
+		"auth_cache_size": authCacheSize, "auth_cache_ttl_ms": int(authCachePositiveTTL / time.Millisecond), "auth_cache_negative_ttl_ms": int(authCacheNegativeTTL / time.Millisecond), "auth_cache_notify_channel": authCacheNotifyChannel,
+		"lockout_threshold": lockoutCfg.threshold, "lockout_window_ms": int(lockoutCfg.window / time.Millisecond), "lockout_duration_ms": int(lockoutCfg.duration / time.Millisecond), "lockout_max_ms": int(lockoutCfg.max / time.Millisecond), "lockout_persist": lockoutPersist,
+		"max_connections_policy": connLimitPolicyString(maxConnectionsPolicy)})
 
 	// 数据库暂不可用时不阻塞插件加载
 	ctx := context.Background()
@@ -148,15 +625,117 @@ func go_mosq_plugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
 		ctx, cancel = context.WithTimeout(context.Background(), timeout)
 	}
 	defer cancel()
-	_, created, err := poolHolder.Ensure(ctx, pgDSN, authPGPoolOptions)
+	poolHolder.Configure(append([]string{pgDSN}, pgReplicaDSNs...), authPGPoolOptions, logPGTarget)
+	if pgBreakerThreshold > 0 {
+		poolHolder.SetBreakers(pgBreakerThreshold, pgBreakerOpen, logPGBreaker)
+	}
+	p, err := poolHolder.Ensure(ctx, pluginutil.PGPrimary)
 	if err != nil {
 		log(mosqLogWarning, "auth-plugin: initial pg connection failed", map[string]any{"error": err.Error()})
-	} else if created {
-		log(mosqLogInfo, "auth-plugin: postgres pool connected", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN)})
+	} else {
+		// SQL 在可连库时立即校验（内置账户查询同时按表结构确定可选列），配置错误直接拒绝加载；
+		// 连不上时延迟到首次使用再校验。
+		verr := authQueries.Validate(ctx, p)
+		poolHolder.Report(p, verr)
+		if verr != nil {
+			log(mosqLogError, "auth-plugin: invalid query", map[string]any{"error": verr.Error()})
+			releaseResources()
+			return C.MOSQ_ERR_UNKNOWN
+		}
 	}
 
-	// 注册回调
+	// 只有一个节点时无需后台探测：连接失败后由下一次请求重新探测。
+	if len(pgReplicaDSNs) > 0 {
+		poolHolder.StartHealthCheck(pgHealthCheckInterval, timeout)
+	}
+
+	if lockoutCfg.threshold > 0 {
+		if lockoutCfg.max < lockoutCfg.duration {
+			lockoutCfg.max = lockoutCfg.duration
+		}
+		authLockouts = newLockoutTracker(lockoutCfg)
+		if lockoutPersist && err == nil {
+			if n, rerr := restoreLockouts(ctx, authLockouts); rerr != nil {
+				log(mosqLogWarning, "auth-plugin: restore lockouts failed", map[string]any{"error": rerr.Error()})
+			} else {
+				log(mosqLogInfo, "auth-plugin: lockouts restored", map[string]any{"count": n})
+			}
+		}
+	}
+	if authEventCfg.size > 0 {
+		authEvents = startAuthEventQueue(authEventCfg, writeAuthEvents)
+		log(mosqLogInfo, "auth-plugin: async auth events enabled", map[string]any{
+			"queue_size": authEventCfg.size,
+			"batch_size": authEventCfg.batchSize,
+			"flush_ms":   int(authEventCfg.flushInterval / time.Millisecond),
+			"fail_mode":  authEventFailModeString(authEventCfg.failMode),
+		})
+	}
+	if lastGoodCfg.size > 0 {
+		lastGood = newLastGoodStore(lastGoodCfg)
+		if lastGoodCfg.path != "" {
+			// 快照只是故障时的兜底，文件损坏不阻止加载，下次保存时覆盖。
+			n, lerr := lastGood.Load(time.Now())
+			if lerr != nil {
+				log(mosqLogWarning, "auth-plugin: load last good credentials failed", map[string]any{"last_good_file": lastGoodCfg.path, "error": lerr.Error()})
+			}
+			log(mosqLogInfo, "auth-plugin: last good credentials loaded", map[string]any{"last_good_file": lastGoodCfg.path, "count": n})
+			lastGood.Start()
+		}
+		log(mosqLogInfo, "auth-plugin: last good credentials enabled", map[string]any{"last_good_size": lastGoodCfg.size, "last_good_max_age_ms": int(lastGoodCfg.maxAge / time.Millisecond), "last_good_file": lastGoodCfg.path})
+	}
+	if authCacheSize > 0 {
+		credentialCache = newAuthCache(authCacheSize, authCachePositiveTTL, authCacheNegativeTTL)
+		if authCacheNotifyChannel != "" {
+			credentialCacheListen = startAuthCacheListener(authCacheNotifyChannel, credentialCache)
+		}
+	}
+	// 认证链依赖上面初始化的各后端，最后构造。
+	names, explicit := authBackendNames, authBackendNames != nil
+	if !explicit {
+		names = defaultAuthBackends
+	}
+	chain, err := buildAuthChain(names, explicit)
+	if err != nil {
+		log(mosqLogError, "auth-plugin: invalid auth_backends", map[string]any{"error": err.Error()})
+		releaseResources()
+		return C.MOSQ_ERR_UNKNOWN
+	}
+	authBackends = chain
+	log(mosqLogInfo, "auth-plugin: auth backends", map[string]any{"auth_backends": authChainNames(chain)})
+
+	// 注册回调；任一失败时注销已注册的回调并释放上面创建的资源。
 	if rc := C.register_event_callback(pid, C.MOSQ_EVT_BASIC_AUTH, C.mosq_event_cb(C.basic_auth_cb_c)); rc != C.MOSQ_ERR_SUCCESS {
+		releaseResources()
+		return rc
+	}
+	if aclCallbackEnabled() {
+		if rc := C.register_event_callback(pid, C.MOSQ_EVT_ACL_CHECK, C.mosq_event_cb(C.acl_check_cb_c)); rc != C.MOSQ_ERR_SUCCESS {
+			unregisterCallbacks()
+			releaseResources()
+			return rc
+		}
+	}
+	if scramEnabled {
+		if rc := C.register_event_callback(pid, C.MOSQ_EVT_EXT_AUTH_START, C.mosq_event_cb(C.ext_auth_start_cb_c)); rc != C.MOSQ_ERR_SUCCESS {
+			unregisterCallbacks()
+			releaseResources()
+			return rc
+		}
+		if rc := C.register_event_callback(pid, C.MOSQ_EVT_EXT_AUTH_CONTINUE, C.mosq_event_cb(C.ext_auth_continue_cb_c)); rc != C.MOSQ_ERR_SUCCESS {
+			unregisterCallbacks()
+			releaseResources()
+			return rc
+		}
+	}
+	if rc := C.register_event_callback(pid, C.MOSQ_EVT_TICK, C.mosq_event_cb(C.tick_cb_c)); rc != C.MOSQ_ERR_SUCCESS {
+		unregisterCallbacks()
+		releaseResources()
+		return rc
+	}
+	if rc := C.register_event_callback(pid, C.MOSQ_EVT_DISCONNECT, C.mosq_event_cb(C.disconnect_cb_c)); rc != C.MOSQ_ERR_SUCCESS {
+		unregisterCallbacks()
+		releaseResources()
 		return rc
 	}
 
@@ -164,47 +743,123 @@ func go_mosq_plugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
 	return C.MOSQ_ERR_SUCCESS
 }
 
+// aclCallbackEnabled 判断是否需要 ACL_CHECK 回调：acl_enabled，启用了会授予连接级 ACL 的令牌/HTTP 认证，
+// 或需要把租户限制在主题前缀内。
+func aclCallbackEnabled() bool {
+	return aclEnabled || (jwtCfg.enabled && jwtCfg.aclClaim != "") || httpAuthCfg.url != "" ||
+		(tenantCfg.separator != "" && tenantCfg.topicPrefix != "")
+}
+
+// unregisterCallbacks 注销全部事件回调；未注册的事件由 Mosquitto 返回错误，忽略即可。
+func unregisterCallbacks() {
+	C.unregister_event_callback(pid, C.MOSQ_EVT_BASIC_AUTH, C.mosq_event_cb(C.basic_auth_cb_c))
+	if aclCallbackEnabled() {
+		C.unregister_event_callback(pid, C.MOSQ_EVT_ACL_CHECK, C.mosq_event_cb(C.acl_check_cb_c))
+	}
+	if scramEnabled {
+		C.unregister_event_callback(pid, C.MOSQ_EVT_EXT_AUTH_START, C.mosq_event_cb(C.ext_auth_start_cb_c))
+		C.unregister_event_callback(pid, C.MOSQ_EVT_EXT_AUTH_CONTINUE, C.mosq_event_cb(C.ext_auth_continue_cb_c))
+	}
+	C.unregister_event_callback(pid, C.MOSQ_EVT_TICK, C.mosq_event_cb(C.tick_cb_c))
+	C.unregister_event_callback(pid, C.MOSQ_EVT_DISCONNECT, C.mosq_event_cb(C.disconnect_cb_c))
+}
+
 // go_mosq_plugin_cleanup 注销回调并释放连接池。
 //
 //export go_mosq_plugin_cleanup
 func go_mosq_plugin_cleanup(userdata unsafe.Pointer, opts *C.struct_mosquitto_opt, optCount C.int) C.int {
-	C.unregister_event_callback(pid, C.MOSQ_EVT_BASIC_AUTH, C.mosq_event_cb(C.basic_auth_cb_c))
-	poolHolder.Close()
+	unregisterCallbacks()
+	authSessions.Reset()
+	scramExchanges.Reset()
+	connACLs.Reset()
+	authConns.Reset()
+	// 等待进行中的重新哈希写库完成，避免连接池关闭后写入失败。
+	rehashWG.Wait()
+	lockoutWG.Wait()
+	// 回调已注销，不会再有新事件。
+	releaseResources()
 	log(mosqLogInfo, "auth-plugin: plugin cleaned up", nil)
 	return C.MOSQ_ERR_SUCCESS
 }
 
-func runBasicAuth(info pluginutil.ClientInfo, password string) C.int {
-	if info.Username == "" || strings.HasPrefix(info.Username, "_") {
+// releaseResources 停止初始化阶段创建的后台任务并关闭连接；写完队列中剩余事件后再关闭连接池。
+// 供 go_mosq_plugin_cleanup 与初始化失败时共用，未创建的资源直接跳过。
+func releaseResources() {
+	stopAuthEventQueue()
+	stopAuthCache()
+	stopLastGood()
+	stopHTTPAuth()
+	poolHolder.Close()
+}
+
+func runBasicAuth(session uintptr, info pluginutil.ClientInfo, password string) C.int {
+	if shouldDefer(info) {
 		return C.MOSQ_ERR_PLUGIN_DEFER
 	}
+	// 格式不合法或协议、监听器不允许时直接拒绝，不访问数据库，也不计入失败锁定。
+	if r := preAuthReason(info); r != "" {
+		recordAuthResult(info, false, r)
+		return C.MOSQ_ERR_AUTH
+	}
 
-	// 默认按拒绝处理；后续根据 DB 返回和 fail_open 逐步覆盖。
-	code := C.int(mosqErrAuth)
-	result := authResultFail
-	reason := ""
-
-	dbAllow, dbReason, dbErr := dbAuth(info.Username, password, info.ClientID)
-	reason = dbReason
-	if dbErr != nil {
-		reason = authReasonDBError
-		log(mosqLogWarning, "auth-plugin auth error", map[string]any{"error": dbErr.Error()})
-		if failOpen {
-			code = C.int(mosqErrSuccess)
-			result = authResultSuccess
-			reason = authReasonDBErrorFailOpen
-			log(mosqLogInfo, "auth-plugin: fail_open allow auth", map[string]any{"reason": authReasonDBError})
+	now := time.Now()
+	// 用户名或来源地址处于锁定期时直接拒绝，不访问数据库。
+	if checkLockout(info, now) {
+		if err := recordAuthEvent(authEvent{info: info, result: authResultFail, reason: authReasonLockedOut}); err != nil {
+			log(mosqLogWarning, "auth-plugin auth event log failed", map[string]any{"error": err.Error()})
 		}
-	} else if dbAllow {
-		code = C.int(mosqErrSuccess)
-		result = authResultSuccess
+		return C.MOSQ_ERR_AUTH
+	}
+	// 同一连接重新认证时先清除旧的连接级 ACL，避免沿用上一次的授权。
+	if session != 0 {
+		connACLs.Forget(session)
 	}
+	return C.int(runAuthChain(authBackends, session, info, password, now))
+}
 
-	if err := recordAuthEvent(info, result, reason); err != nil {
-		log(mosqLogWarning, "auth-plugin auth event log failed", map[string]any{"error": err.Error()})
+func runACLCheck(session uintptr, info pluginutil.ClientInfo, topic string, access int) C.int {
+	// 与 BASIC_AUTH 一致：命中 defer_rules 的连接交给内建 acl_file。
+	if _, ok := matchDeferRule(deferRules, info); ok {
+		return C.MOSQ_ERR_PLUGIN_DEFER
+	}
+	// 取消订阅不涉及数据访问，直接放行。
+	if access == mosqACLUnsubscribe {
+		return C.MOSQ_ERR_SUCCESS
+	}
+	// 租户连接只能访问本租户的主题前缀，先于超级用户与其它 ACL 判定。
+	if !tenantTopicAllowed(info.Username, topic) {
+		return C.MOSQ_ERR_ACL_DENIED
+	}
+	// 认证时已确定 ACL 的连接（令牌声明、HTTP 响应）只按连接级 ACL 判定，不访问数据库。
+	if acl, ok := connACLs.Get(session); ok {
+		if acl.superuser {
+			return C.MOSQ_ERR_SUCCESS
+		}
+		if allow, _ := evaluateACL(acl.rules, info, topic, access); allow {
+			return C.MOSQ_ERR_SUCCESS
+		}
+		return C.MOSQ_ERR_ACL_DENIED
+	}
+	// 仅因连接级 ACL 注册的回调：其它连接交给其它插件或 acl_file。
+	if !aclEnabled {
+		return C.MOSQ_ERR_PLUGIN_DEFER
 	}
 
-	return code
+	rules, err := loadACLRules(info)
+	if err != nil {
+		if pluginutil.ShouldSample(&aclWarnCounter, debugSampleEvery) {
+			log(mosqLogWarning, "auth-plugin acl error", map[string]any{"error": err.Error(), "fail_open": failOpen})
+		}
+		if failOpen {
+			return C.MOSQ_ERR_SUCCESS
+		}
+		return C.MOSQ_ERR_ACL_DENIED
+	}
+	// 无规则命中时默认拒绝，与 acl_file 的兜底语义一致。
+	if allow, _ := evaluateACL(rules, info, topic, access); allow {
+		return C.MOSQ_ERR_SUCCESS
+	}
+	return C.MOSQ_ERR_ACL_DENIED
 }
 
 // basic_auth_cb_c 执行认证逻辑并返回结果。
@@ -218,7 +873,167 @@ func basic_auth_cb_c(event C.int, event_data unsafe.Pointer, userdata unsafe.Poi
 	ed := (*C.struct_mosquitto_evt_basic_auth)(event_data)
 	password := cstr(ed.password)
 	info := clientInfoFromBasicAuth(ed)
-	return runBasicAuth(info, password)
+	// 无密码且出示了客户端证书时按证书身份认证；带密码的连接仍走口令/JWT 流程。
+	if certAuthEnabled && password == "" {
+		if cert := clientCertificate(ed.client); cert != nil {
+			res := runCertAuth(sessionKey(ed.client), info, cert)
+			// CONNECT 未带用户名时以证书身份作为用户名，供 ACL 与其它插件使用。
+			if res.code == mosqErrSuccess && info.Username == "" {
+				setClientUsername(ed.client, res.username)
+			}
+			return C.int(res.code)
+		}
+	}
+	return runBasicAuth(sessionKey(ed.client), info, password)
+}
+
+// acl_check_cb_c 执行 ACL 判定并返回结果。
+//
+//export acl_check_cb_c
+func acl_check_cb_c(event C.int, event_data unsafe.Pointer, userdata unsafe.Pointer) C.int {
+	if event_data == nil {
+		log(mosqLogWarning, "auth-plugin: nil acl check event_data", map[string]any{"event": int(event)})
+		return C.MOSQ_ERR_ACL_DENIED
+	}
+	ed := (*C.struct_mosquitto_evt_acl_check)(event_data)
+	info := clientInfoFromClient(ed.client)
+	return runACLCheck(sessionKey(ed.client), info, cstr(ed.topic), int(ed.access))
+}
+
+// tick_cb_c 周期性断开已过期或被 max_connections 挤掉的连接，并清理过期的 SCRAM 交换。
+//
+//export tick_cb_c
+func tick_cb_c(event C.int, event_data unsafe.Pointer, userdata unsafe.Pointer) C.int {
+	now := time.Now()
+	kickExpiredSessions(now)
+	kickOverLimitConnections()
+	scramExchanges.Prune(now)
+	return C.MOSQ_ERR_SUCCESS
+}
+
+// disconnect_cb_c 在连接断开时清理该连接的会话状态。
+//
+//export disconnect_cb_c
+func disconnect_cb_c(event C.int, event_data unsafe.Pointer, userdata unsafe.Pointer) C.int {
+	ed := (*C.struct_mosquitto_evt_disconnect)(event_data)
+	if ed == nil {
+		return C.MOSQ_ERR_SUCCESS
+	}
+	if key := sessionKey(ed.client); key != 0 {
+		authSessions.Forget(key)
+		scramExchanges.Forget(key)
+		connACLs.Forget(key)
+		authConns.Forget(key)
+	}
+	return C.MOSQ_ERR_SUCCESS
+}
+
+// sessionKey 用客户端指针地址作为会话键，跨 BASIC_AUTH/DISCONNECT 回调关联同一连接。
+func sessionKey(client *C.struct_mosquitto) uintptr {
+	return uintptr(unsafe.Pointer(client))
+}
+
+// kickExpiredSessions 断开 valid_until 已到的会话；Mosquitto 在主循环中回调 TICK，此处不访问数据库。
+func kickExpiredSessions(now time.Time) {
+	for _, s := range authSessions.Expired(now) {
+		log(mosqLogInfo, "auth-plugin: account expired, disconnecting client", map[string]any{
+			"client_id":   s.clientID,
+			"username":    s.username,
+			"valid_until": s.validUntil.UTC().Format(time.RFC3339),
+		})
+		if pid == nil || s.clientID == "" {
+			continue
+		}
+		cs := C.CString(s.clientID)
+		C.mosquitto_kick_client_by_clientid(cs, C.bool(false))
+		C.free(unsafe.Pointer(cs))
+	}
+}
+
+// kickOverLimitConnections 断开因 max_connections（kick_oldest）被挤掉的连接。
+func kickOverLimitConnections() {
+	if pid == nil {
+		return
+	}
+	for _, id := range authConns.TakeKicks() {
+		if id == "" {
+			continue
+		}
+		cs := C.CString(id)
+		C.mosquitto_kick_client_by_clientid(cs, C.bool(false))
+		C.free(unsafe.Pointer(cs))
+	}
+}
+
+// ext_auth_start_cb_c 处理 SCRAM-SHA-256 增强认证的首条 AUTH 数据。
+//
+//export ext_auth_start_cb_c
+func ext_auth_start_cb_c(event C.int, event_data unsafe.Pointer, userdata unsafe.Pointer) C.int {
+	if event_data == nil {
+		return C.MOSQ_ERR_AUTH
+	}
+	ed := (*C.struct_mosquitto_evt_extended_auth)(event_data)
+	// 只处理 SCRAM-SHA-256，其它认证方法交给后续插件。
+	if cstr(ed.auth_method) != pluginutil.SCRAMSHA256 {
+		return C.MOSQ_ERR_PLUGIN_DEFER
+	}
+	res := runSCRAMStart(sessionKey(ed.client), clientInfoFromClient(ed.client), extAuthDataIn(ed))
+	setExtAuthDataOut(ed, res.out)
+	return C.int(res.code)
+}
+
+// ext_auth_continue_cb_c 处理 SCRAM-SHA-256 增强认证的后续 AUTH 数据。
+//
+//export ext_auth_continue_cb_c
+func ext_auth_continue_cb_c(event C.int, event_data unsafe.Pointer, userdata unsafe.Pointer) C.int {
+	if event_data == nil {
+		return C.MOSQ_ERR_AUTH
+	}
+	ed := (*C.struct_mosquitto_evt_extended_auth)(event_data)
+	if cstr(ed.auth_method) != pluginutil.SCRAMSHA256 {
+		return C.MOSQ_ERR_PLUGIN_DEFER
+	}
+	res := runSCRAMContinue(sessionKey(ed.client), extAuthDataIn(ed))
+	if res.code == mosqErrSuccess && ed.client != nil && cstr(C.mosquitto_client_username(ed.client)) == "" {
+		// CONNECT 未携带用户名时，以 SCRAM 用户名作为连接用户名，供 ACL 使用。
+		setClientUsername(ed.client, res.username)
+	}
+	setExtAuthDataOut(ed, res.out)
+	return C.int(res.code)
+}
+
+// setClientUsername 设置连接用户名，认证方式本身不携带 CONNECT 用户名时使用。
+func setClientUsername(client *C.struct_mosquitto, username string) {
+	if client == nil {
+		return
+	}
+	cs := C.CString(username)
+	defer C.free(unsafe.Pointer(cs))
+	if rc := C.mosquitto_set_username(client, cs); rc != C.MOSQ_ERR_SUCCESS {
+		log(mosqLogWarning, "auth-plugin: set username failed", map[string]any{"username": username, "rc": int(rc)})
+	}
+}
+
+// extAuthDataIn 复制客户端发来的 AUTH 数据；无数据时返回 nil。
+func extAuthDataIn(ed *C.struct_mosquitto_evt_extended_auth) []byte {
+	if ed.data_in == nil || ed.data_in_len == 0 {
+		return nil
+	}
+	return C.GoBytes(ed.data_in, C.int(ed.data_in_len))
+}
+
+// setExtAuthDataOut 以 mosquitto_malloc 分配回送数据，由 Broker 负责释放。
+func setExtAuthDataOut(ed *C.struct_mosquitto_evt_extended_auth, out []byte) {
+	if len(out) == 0 {
+		return
+	}
+	buf := C.mosquitto_malloc(C.size_t(len(out)))
+	if buf == nil {
+		return
+	}
+	copy(unsafe.Slice((*byte)(buf), len(out)), out)
+	ed.data_out = buf
+	ed.data_out_len = C.uint16_t(len(out))
 }
 
 func main() {}
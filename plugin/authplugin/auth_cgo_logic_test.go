@@ -12,7 +12,7 @@ func TestRunBasicAuthDefer(t *testing.T) {
 		{ClientID: "c1", Username: "_ops"},
 	}
 	for _, info := range tests {
-		got := runBasicAuth(info, "pwd")
+		got := runBasicAuth(0, info, "pwd")
 		if int(got) != mosqErrDefer {
 			t.Fatalf("defer mismatch for %q: got=%d", info.Username, int(got))
 		}
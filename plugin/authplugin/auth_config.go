@@ -1,6 +1,9 @@
 package main
 
-import "strings"
+import (
+	"strconv"
+	"strings"
+)
 
 // parseBoolOption 解析 auth 插件配置中的布尔值。
 func parseBoolOption(v string) (value bool, ok bool) {
@@ -13,3 +16,12 @@ func parseBoolOption(v string) (value bool, ok bool) {
 		return false, false
 	}
 }
+
+// parseNonNegativeInt 解析允许为 0 的整数配置（0 通常表示关闭对应功能）。
+func parseNonNegativeInt(v string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -26,3 +26,22 @@ func TestParseBoolOption(t *testing.T) {
 		})
 	}
 }
+
+func TestParseNonNegativeInt(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   int
+		wantOK bool
+	}{
+		{input: "0", want: 0, wantOK: true},
+		{input: " 4096 ", want: 4096, wantOK: true},
+		{input: "-1", want: 0, wantOK: false},
+		{input: "abc", want: 0, wantOK: false},
+	}
+	for _, tc := range tests {
+		got, ok := parseNonNegativeInt(tc.input)
+		if got != tc.want || ok != tc.wantOK {
+			t.Fatalf("parseNonNegativeInt(%q) = (%v, %v), want (%v, %v)", tc.input, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
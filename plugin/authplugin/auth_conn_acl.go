@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+var errACLGrant = errors.New("invalid acl grant")
+
+// parseACLGrant 将外部授予的 ACL（JWT 声明、HTTP 认证响应）转换为放行规则：{"pub":[...], "sub":[...]}。
+// pub 授予发布（write），sub 授予订阅及接收（subscribe|read）；raw 为 nil 时返回 nil。
+func parseACLGrant(raw any) ([]aclRule, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	obj, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errACLGrant
+	}
+	// 非 nil 的空切片表示授予存在但不含任何主题，ACL 一律拒绝。
+	rules := []aclRule{}
+	for key, access := range map[string]int{"pub": mosqACLWrite, "sub": mosqACLSubscribe | mosqACLRead} {
+		v, ok := obj[key]
+		if !ok || v == nil {
+			continue
+		}
+		list, ok := v.([]any)
+		if !ok {
+			return nil, errACLGrant
+		}
+		for _, item := range list {
+			filter, ok := item.(string)
+			if !ok || !validACLFilter(filter) {
+				return nil, errACLGrant
+			}
+			rules = append(rules, aclRule{topic: filter, access: access, allow: true})
+		}
+	}
+	return rules, nil
+}
+
+// validACLFilter 检查主题过滤器语法：# 只能位于末层，通配符必须独占一层。
+func validACLFilter(filter string) bool {
+	if filter == "" {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, l := range levels {
+		if strings.ContainsAny(l, "+#") && len(l) != 1 {
+			return false
+		}
+		if l == "#" && i != len(levels)-1 {
+			return false
+		}
+	}
+	return true
+}
+
+// connACL 为认证时确定、按连接保存的 ACL；superuser=true 时跳过规则检查。
+type connACL struct {
+	rules     []aclRule
+	superuser bool
+}
+
+// connACLTracker 以客户端指针地址为键保存连接级 ACL（JWT 声明、HTTP 认证响应），ACL_CHECK 时无需访问数据库。
+type connACLTracker struct {
+	mu   sync.RWMutex
+	acls map[uintptr]connACL
+}
+
+func newConnACLTracker() *connACLTracker {
+	return &connACLTracker{acls: map[uintptr]connACL{}}
+}
+
+// Put 登记连接的 ACL；既无规则也非超级用户时仅清除旧记录。
+func (t *connACLTracker) Put(key uintptr, acl connACL) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if acl.rules == nil && !acl.superuser {
+		delete(t.acls, key)
+		return
+	}
+	t.acls[key] = acl
+}
+
+// Get 返回连接的 ACL；ok=false 表示该连接没有连接级 ACL。
+func (t *connACLTracker) Get(key uintptr) (connACL, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	acl, ok := t.acls[key]
+	return acl, ok
+}
+
+// Forget 移除连接的 ACL。
+func (t *connACLTracker) Forget(key uintptr) {
+	t.mu.Lock()
+	delete(t.acls, key)
+	t.mu.Unlock()
+}
+
+// Len 返回当前保存的连接数。
+func (t *connACLTracker) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.acls)
+}
+
+// Reset 清空全部连接级 ACL，插件重载时调用。
+func (t *connACLTracker) Reset() {
+	t.mu.Lock()
+	t.acls = map[uintptr]connACL{}
+	t.mu.Unlock()
+}
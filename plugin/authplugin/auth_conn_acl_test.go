@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func TestParseJWTACLClaim(t *testing.T) {
+	claims := pluginutil.JWTClaims{"mqtt_acl": map[string]any{
+		"pub": []any{"v1/d/%c/up"},
+		"sub": []any{"v1/d/%c/cmd/#"},
+	}}
+	rules, err := parseJWTACLClaim(claims, "mqtt_acl")
+	if err != nil || len(rules) != 2 {
+		t.Fatalf("parseJWTACLClaim = %v, %v", rules, err)
+	}
+	info := pluginutil.ClientInfo{Username: "alice", ClientID: "c1"}
+	checks := []struct {
+		topic  string
+		access int
+		want   bool
+	}{
+		{"v1/d/c1/up", mosqACLWrite, true},
+		{"v1/d/c1/up", mosqACLSubscribe, false},
+		{"v1/d/c1/cmd/reboot", mosqACLRead, true},
+		{"v1/d/c1/cmd/#", mosqACLSubscribe, true},
+		{"v1/d/c1/cmd/reboot", mosqACLWrite, false},
+		{"v1/d/c2/up", mosqACLWrite, false},
+	}
+	for _, c := range checks {
+		if allow, _ := evaluateACL(rules, info, c.topic, c.access); allow != c.want {
+			t.Errorf("%s access=%d: allow=%v want %v", c.topic, c.access, allow, c.want)
+		}
+	}
+
+	if rules, err := parseJWTACLClaim(pluginutil.JWTClaims{}, "mqtt_acl"); rules != nil || err != nil {
+		t.Fatalf("absent claim = %v, %v", rules, err)
+	}
+	if rules, err := parseJWTACLClaim(pluginutil.JWTClaims{"mqtt_acl": map[string]any{}}, "mqtt_acl"); rules == nil || len(rules) != 0 || err != nil {
+		t.Fatalf("empty claim should grant nothing: %v, %v", rules, err)
+	}
+	for _, bad := range []any{
+		"v1/#",
+		map[string]any{"pub": "v1/#"},
+		map[string]any{"sub": []any{1}},
+		map[string]any{"sub": []any{"v1/#/x"}},
+		map[string]any{"pub": []any{"v1/a+"}},
+	} {
+		if _, err := parseJWTACLClaim(pluginutil.JWTClaims{"mqtt_acl": bad}, "mqtt_acl"); err == nil {
+			t.Errorf("claim %v should be rejected", bad)
+		}
+	}
+}
+
+func TestRunACLCheckConnACL(t *testing.T) {
+	prevEnabled := aclEnabled
+	t.Cleanup(func() {
+		aclEnabled = prevEnabled
+		connACLs.Reset()
+	})
+	aclEnabled = false
+	info := pluginutil.ClientInfo{Username: "alice", ClientID: "c1"}
+	connACLs.Put(42, connACL{rules: []aclRule{{topic: "v1/d/%c/up", access: mosqACLWrite, allow: true}}})
+	connACLs.Put(44, connACL{superuser: true})
+
+	if got := runACLCheck(42, info, "v1/d/c1/up", mosqACLWrite); int(got) != mosqErrSuccess {
+		t.Fatalf("token rule should allow: got=%d", int(got))
+	}
+	if got := runACLCheck(42, info, "v1/d/c1/down", mosqACLWrite); int(got) != mosqErrACLDenied {
+		t.Fatalf("unmatched topic should be denied: got=%d", int(got))
+	}
+	if got := runACLCheck(44, info, "any/topic", mosqACLWrite); int(got) != mosqErrSuccess {
+		t.Fatalf("superuser should bypass rules: got=%d", int(got))
+	}
+	// 没有连接级 ACL 且未开启 acl_enabled 时交给其它 ACL 机制。
+	if got := runACLCheck(43, info, "v1/d/c1/up", mosqACLWrite); int(got) != mosqErrDefer {
+		t.Fatalf("connection without token acl should defer: got=%d", int(got))
+	}
+
+	connACLs.Forget(42)
+	connACLs.Put(44, connACL{})
+	if connACLs.Len() != 0 {
+		t.Fatalf("Forget and empty Put should remove entries")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// connLimitPolicy 控制账户连接数达到 max_connections 后新登录的处理方式。
+type connLimitPolicy int
+
+const (
+	// connLimitReject 拒绝新登录（too_many_connections）。
+	connLimitReject connLimitPolicy = iota
+	// connLimitKickOldest 放行新登录并断开该账户最早的连接。
+	connLimitKickOldest
+)
+
+// parseConnLimitPolicy 解析 max_connections_policy。
+func parseConnLimitPolicy(v string) (connLimitPolicy, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "reject":
+		return connLimitReject, true
+	case "kick_oldest":
+		return connLimitKickOldest, true
+	default:
+		return connLimitReject, false
+	}
+}
+
+// connLimitPolicyString 将策略转回配置字符串。
+func connLimitPolicyString(p connLimitPolicy) string {
+	if p == connLimitKickOldest {
+		return "kick_oldest"
+	}
+	return "reject"
+}
+
+// accountConn 为一个已认证的连接；seq 按认证先后递增，用于找出最早的连接。
+type accountConn struct {
+	username string
+	clientID string
+	seq      uint64
+}
+
+// accountConnTracker 按用户名统计在线连接，认证成功时登记、DISCONNECT 时移除，线程安全。
+type accountConnTracker struct {
+	mu       sync.Mutex
+	seq      uint64
+	sessions map[uintptr]*accountConn
+	byUser   map[string]map[uintptr]*accountConn
+	// kicks 为待断开的 clientid，在 TICK 回调中执行，避免在认证回调内断开其它连接。
+	kicks []string
+}
+
+func newAccountConnTracker() *accountConnTracker {
+	return &accountConnTracker{sessions: map[uintptr]*accountConn{}, byUser: map[string]map[uintptr]*accountConn{}}
+}
+
+// Admit 登记连接并检查上限（limit<=0 表示不限制）。与新连接 clientid 相同的旧连接即将被会话接管，不计入；
+// 同一 clientid 的多条连接按一个计数。超限时按策略拒绝（ok=false）或移除最早的连接并返回其 clientid。
+func (t *accountConnTracker) Admit(session uintptr, username, clientID string, limit int, policy connLimitPolicy) (kicked []string, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// 同一连接重新认证时先移除旧登记（用户名可能已变化）。
+	t.forgetLocked(session)
+
+	if limit > 0 {
+		oldest := map[string]uint64{}
+		for _, c := range t.byUser[username] {
+			if c.clientID == clientID {
+				continue
+			}
+			if seq, found := oldest[c.clientID]; !found || c.seq < seq {
+				oldest[c.clientID] = c.seq
+			}
+		}
+		if excess := len(oldest) - limit + 1; excess > 0 {
+			if policy != connLimitKickOldest {
+				return nil, false
+			}
+			ids := make([]string, 0, len(oldest))
+			for id := range oldest {
+				ids = append(ids, id)
+			}
+			sort.Slice(ids, func(i, j int) bool { return oldest[ids[i]] < oldest[ids[j]] })
+			kicked = ids[:excess]
+			for _, id := range kicked {
+				for key, c := range t.byUser[username] {
+					if c.clientID == id {
+						t.forgetLocked(key)
+					}
+				}
+			}
+			t.kicks = append(t.kicks, kicked...)
+		}
+	}
+
+	t.seq++
+	c := &accountConn{username: username, clientID: clientID, seq: t.seq}
+	t.sessions[session] = c
+	if t.byUser[username] == nil {
+		t.byUser[username] = map[uintptr]*accountConn{}
+	}
+	t.byUser[username][session] = c
+	return kicked, true
+}
+
+// Forget 移除连接。
+func (t *accountConnTracker) Forget(session uintptr) {
+	t.mu.Lock()
+	t.forgetLocked(session)
+	t.mu.Unlock()
+}
+
+// Count 返回用户名当前登记的连接数。
+func (t *accountConnTracker) Count(username string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.byUser[username])
+}
+
+// TakeKicks 取出待断开的 clientid。
+func (t *accountConnTracker) TakeKicks() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := t.kicks
+	t.kicks = nil
+	return out
+}
+
+// Reset 清空全部连接，插件重载时调用。
+func (t *accountConnTracker) Reset() {
+	t.mu.Lock()
+	t.sessions = map[uintptr]*accountConn{}
+	t.byUser = map[string]map[uintptr]*accountConn{}
+	t.kicks = nil
+	t.mu.Unlock()
+}
+
+func (t *accountConnTracker) forgetLocked(session uintptr) {
+	c, ok := t.sessions[session]
+	if !ok {
+		return
+	}
+	delete(t.sessions, session)
+	if conns := t.byUser[c.username]; conns != nil {
+		delete(conns, session)
+		if len(conns) == 0 {
+			delete(t.byUser, c.username)
+		}
+	}
+}
+
+// admitConnection 在凭据与账户属性都通过后登记连接；超过 max_connections 且策略为 reject 时返回拒绝原因。
+func admitConnection(session uintptr, info pluginutil.ClientInfo, attrs accountAttrs) string {
+	if session == 0 {
+		return ""
+	}
+	kicked, ok := authConns.Admit(session, info.Username, info.ClientID, attrs.maxConnections, maxConnectionsPolicy)
+	if !ok {
+		log(mosqLogInfo, "auth-plugin: too many connections", map[string]any{"username": info.Username, "client_id": info.ClientID, "max_connections": attrs.maxConnections})
+		return authReasonTooManyConnections
+	}
+	for _, id := range kicked {
+		log(mosqLogInfo, "auth-plugin: max_connections reached, kicking oldest connection", map[string]any{"username": info.Username, "client_id": id, "max_connections": attrs.maxConnections})
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func TestParseConnLimitPolicy(t *testing.T) {
+	for v, want := range map[string]connLimitPolicy{"reject": connLimitReject, " Kick_Oldest ": connLimitKickOldest} {
+		if got, ok := parseConnLimitPolicy(v); !ok || got != want {
+			t.Errorf("parseConnLimitPolicy(%q) = %v, %v", v, got, ok)
+		}
+	}
+	if _, ok := parseConnLimitPolicy("drop"); ok {
+		t.Error("unknown policy should be rejected")
+	}
+}
+
+func TestAccountConnTrackerReject(t *testing.T) {
+	tr := newAccountConnTracker()
+	if _, ok := tr.Admit(1, "dev", "c1", 2, connLimitReject); !ok {
+		t.Fatal("first connection should be admitted")
+	}
+	if _, ok := tr.Admit(2, "dev", "c2", 2, connLimitReject); !ok {
+		t.Fatal("second connection should be admitted")
+	}
+	if _, ok := tr.Admit(3, "dev", "c3", 2, connLimitReject); ok {
+		t.Fatal("third connection should be rejected")
+	}
+	// 同一 clientid 重连会接管旧会话，不计入上限。
+	if _, ok := tr.Admit(4, "dev", "c1", 2, connLimitReject); !ok {
+		t.Fatal("reconnect with same client id should be admitted")
+	}
+	// 其它账户与不限制的账户不受影响。
+	if _, ok := tr.Admit(5, "other", "c3", 2, connLimitReject); !ok {
+		t.Fatal("other account should be admitted")
+	}
+	if _, ok := tr.Admit(6, "dev", "c4", 0, connLimitReject); !ok {
+		t.Fatal("limit 0 should not restrict")
+	}
+
+	tr.Forget(2)
+	tr.Forget(6)
+	if _, ok := tr.Admit(7, "dev", "c3", 2, connLimitReject); !ok {
+		t.Fatal("connection should be admitted after disconnect")
+	}
+	// 被拒绝的连接不登记：剩余 1、4（同为 c1）与 7。
+	if got := tr.Count("dev"); got != 3 {
+		t.Fatalf("Count = %d, want 3", got)
+	}
+}
+
+func TestAccountConnTrackerKickOldest(t *testing.T) {
+	tr := newAccountConnTracker()
+	tr.Admit(1, "dev", "c1", 2, connLimitKickOldest)
+	tr.Admit(2, "dev", "c2", 2, connLimitKickOldest)
+	kicked, ok := tr.Admit(3, "dev", "c3", 2, connLimitKickOldest)
+	if !ok || !reflect.DeepEqual(kicked, []string{"c1"}) {
+		t.Fatalf("Admit = %v, %v; want [c1], true", kicked, ok)
+	}
+	if got := tr.Count("dev"); got != 2 {
+		t.Fatalf("Count = %d, want 2", got)
+	}
+	// 上限调低后一次挤掉多个最早的连接。
+	kicked, _ = tr.Admit(4, "dev", "c4", 1, connLimitKickOldest)
+	if !reflect.DeepEqual(kicked, []string{"c2", "c3"}) {
+		t.Fatalf("kicked = %v, want [c2 c3]", kicked)
+	}
+	if got := tr.TakeKicks(); !reflect.DeepEqual(got, []string{"c1", "c2", "c3"}) {
+		t.Fatalf("TakeKicks = %v", got)
+	}
+	if got := tr.TakeKicks(); got != nil {
+		t.Fatalf("TakeKicks should drain, got %v", got)
+	}
+	// 被挤掉的连接断开时不影响计数。
+	tr.Forget(1)
+	if got := tr.Count("dev"); got != 1 {
+		t.Fatalf("Count = %d, want 1", got)
+	}
+}
+
+func TestAccountConnTrackerReauth(t *testing.T) {
+	tr := newAccountConnTracker()
+	tr.Admit(1, "a", "c1", 1, connLimitReject)
+	// 同一连接重新认证为其它账户时从原账户移除。
+	tr.Admit(1, "b", "c1", 1, connLimitReject)
+	if tr.Count("a") != 0 || tr.Count("b") != 1 {
+		t.Fatalf("counts = %d, %d", tr.Count("a"), tr.Count("b"))
+	}
+}
+
+func TestRunAuthChainTooManyConnections(t *testing.T) {
+	defer authConns.Reset()
+	defer connACLs.Reset()
+	defer authSessions.Reset()
+
+	var calls int
+	out := authOutcome{decision: authAllow, reason: authReasonOK, attrs: accountAttrs{maxConnections: 1}}
+	chain := []authenticator{stubAuthenticator{name: "stub", out: out, calls: &calls}}
+	if code := runAuthChain(chain, 1, pluginutil.ClientInfo{Username: "dev", ClientID: "c1"}, "pwd", time.Now()); code != mosqErrSuccess {
+		t.Fatalf("first login code = %d", code)
+	}
+	if code := runAuthChain(chain, 2, pluginutil.ClientInfo{Username: "dev", ClientID: "c2"}, "pwd", time.Now()); code != mosqErrAuth {
+		t.Fatalf("second login code = %d, want %d", code, mosqErrAuth)
+	}
+	authConns.Forget(1)
+	if code := runAuthChain(chain, 2, pluginutil.ClientInfo{Username: "dev", ClientID: "c2"}, "pwd", time.Now()); code != mosqErrSuccess {
+		t.Fatalf("login after disconnect code = %d", code)
+	}
+}
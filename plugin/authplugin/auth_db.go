@@ -2,19 +2,100 @@ package main
 
 import (
 	"context"
-	"errors"
+	"net/netip"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"mosquitto-plugin/internal/pluginutil"
 )
 
-// dbAuth 执行认证逻辑并返回结果/原因。
-func dbAuth(username, password, clientID string) (bool, string, error) {
+// dbAuth 执行认证逻辑并返回结果/原因；acct 在账户存在时填充，属性仅在凭据有效时供缓存之后的检查使用。
+func dbAuth(username, password, clientID string) (bool, string, authAccount, error) {
 	if username == "" || password == "" {
-		return false, authReasonMissingCreds, nil
+		return false, authReasonMissingCreds, authAccount{}, nil
 	}
+	acct, found, err := lookupAccount(username, clientID)
+	if err != nil {
+		// DB 运行时错误交给上层 runBasicAuth 统一处理 fail_open。
+		return false, "", authAccount{}, err
+	}
+	if !found {
+		return false, authReasonUserNotFound, authAccount{}, nil
+	}
+	if !acct.enabled {
+		return false, authReasonUserDisabled, acct, nil
+	}
+	// 先校验 clientid 绑定，不匹配时无需计算密码哈希。
+	if !clientIDBound(acct, clientID, enforceBind) {
+		return false, authReasonClientIDMismatch, acct, nil
+	}
+	// 按 password_hash 前缀选择算法；无前缀时沿用 sha256(password + salt)。
+	ok, err := pluginutil.VerifyPassword(password, acct.passwordHash, acct.salt)
+	if err != nil {
+		// 哈希格式问题属于数据错误，按拒绝处理，避免被 fail_open 放行。
+		log(mosqLogWarning, "auth-plugin: unsupported password hash", map[string]any{"username": username, "error": err.Error()})
+		return false, authReasonUnsupportedHash, acct, nil
+	}
+	if !ok {
+		return false, authReasonInvalidPassword, acct, nil
+	}
+	// 仍在使用旧算法的账号异步升级到首选算法，不阻塞本次认证。
+	if rehashOnLogin && needsRehash(acct.passwordHash) && scheduleRehash(username, password, acct.passwordHash) {
+		return true, authReasonOKRehash, acct, nil
+	}
+
+	return true, authReasonOK, acct, nil
+}
+
+// postgresAuthenticator 查询账户表；DB 错误不缓存，先查最近成功凭据快照，未命中再交由链按 fail_open 处理。
+type postgresAuthenticator struct{}
+
+func (postgresAuthenticator) Name() string { return authBackendPostgres }
+
+func (postgresAuthenticator) Authenticate(req *authRequest) authOutcome {
+	allow, reason, acct, err := dbAuth(req.info.Username, req.password, req.info.ClientID)
+	if err != nil {
+		if out, ok := lastGoodFallback(req, err); ok {
+			return out
+		}
+		return authOutcome{decision: authDeny, reason: authReasonDBError, err: err, failOpenReason: authReasonDBErrorFailOpen}
+	}
+	var attrs accountAttrs
+	if allow {
+		attrs = acct.accountAttrs
+	}
+	if req.cache != nil {
+		req.cache.Put(req.cacheKey, allow, reason, attrs, req.cacheGen, req.now)
+		logAuthCacheStats(req.cache)
+	}
+	if s := lastGood; s != nil {
+		s.Observe(req.info, allow, reason, acct, req.now)
+	}
+	return dbOutcome(allow, reason, attrs)
+}
+
+// logPGTarget 在读写目标切换时输出日志，便于确认当前连接的节点。
+func logPGTarget(role pluginutil.PGRole, dsn string) {
+	if dsn == "" {
+		log(mosqLogWarning, "auth-plugin: no healthy postgres target", map[string]any{"role": role.String()})
+		return
+	}
+	log(mosqLogInfo, "auth-plugin: postgres target selected", map[string]any{"role": role.String(), "pg_dsn": pluginutil.SafeDSN(dsn)})
+}
+
+// logPGBreaker 输出熔断器状态变化；打开期间数据库请求直接按错误处理（fail_open 生效）。
+func logPGBreaker(dsn string, from, to pluginutil.BreakerState) {
+	level := mosqLogInfo
+	if to == pluginutil.BreakerOpen {
+		level = mosqLogWarning
+	}
+	log(level, "auth-plugin: postgres circuit breaker", map[string]any{"pg_dsn": pluginutil.SafeDSN(dsn), "from": from.String(), "to": to.String()})
+}
+
+// lookupAccount 在超时控制下读取账户行，供 BASIC_AUTH 与增强认证共用。
+func lookupAccount(username, clientID string) (authAccount, bool, error) {
 	ctx := context.Background()
 	cancel := func() {}
 	// 保留 timeout<=0 时“无超时”的旧行为。
@@ -23,36 +104,154 @@ func dbAuth(username, password, clientID string) (bool, string, error) {
 	}
 	defer cancel()
 
-	p, created, err := poolHolder.Ensure(ctx, pgDSN, authPGPoolOptions)
+	// 账户读取是只读查询，优先走副本。
+	p, err := poolHolder.Ensure(ctx, pluginutil.PGReplica)
 	if err != nil {
-		return false, "", err
-	}
-	if created {
-		log(mosqLogInfo, "auth-plugin: postgres pool connected", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN)})
+		return authAccount{}, false, err
 	}
-	var passwordHash string
-	var salt string
-	var enabled int16
-	err = p.QueryRow(ctx, selectAuthAccountSQL, username, clientID).Scan(&passwordHash, &salt, &enabled)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return false, authReasonUserNotFound, nil
+	if err := authQueries.Ensure(ctx, p); err != nil {
+		poolHolder.Report(p, err)
+		return authAccount{}, false, err
 	}
+	acct, found, err := loadAccount(ctx, p, username, clientID)
+	poolHolder.Report(p, err)
+	return acct, found, err
+}
+
+// loadAccount 执行账户查询，按列名映射各行后由 pickAccountRow 选取一行；found=false 表示无记录。
+func loadAccount(ctx context.Context, p *pgxpool.Pool, username, clientID string) (authAccount, bool, error) {
+	// 多租户时以去掉租户前缀的账户名查询，租户作为 $3 或 schema 限定查询范围。
+	tenant, name, _ := splitTenant(username)
+	query, n := tenantAccountQuery(tenant)
+	args := []any{name, clientID, pluginutil.OptionalString(tenant)}
+	rows, err := p.Query(ctx, query, args[:n]...)
 	if err != nil {
-		// DB 运行时错误交给上层 runBasicAuth 统一处理 fail_open。
-		return false, "", err
+		if tenantTableMissing(tenant, err) {
+			return authAccount{}, false, nil
+		}
+		return authAccount{}, false, err
+	}
+	defer rows.Close()
+	var accts []authAccount
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return authAccount{}, false, err
+		}
+		accts = append(accts, accountFromRow(rows.FieldDescriptions(), values, username))
+	}
+	if err := rows.Err(); err != nil && !tenantTableMissing(tenant, err) {
+		return authAccount{}, false, err
 	}
-	if enabled == 0 {
-		return false, authReasonUserDisabled, nil
+	acct, found := pickAccountRow(accts, clientID)
+	return acct, found, nil
+}
+
+// pickAccountRow 从同一用户名的多行中选取用于认证的一行：优先取已绑定且与 clientID 匹配的行
+// （精确匹配已由查询排在最前，其次为 prefix/regex 匹配），否则取首行（未绑定的行，或绑定到其它 clientid 的行）。
+func pickAccountRow(accts []authAccount, clientID string) (authAccount, bool) {
+	if len(accts) == 0 {
+		return authAccount{}, false
 	}
-	if passwordHash != sha256PwdSalt(password, salt) {
-		return false, authReasonInvalidPassword, nil
+	for _, acct := range accts {
+		if acct.clientID != "" && clientIDBound(acct, clientID, true) {
+			return acct, true
+		}
 	}
+	return accts[0], true
+}
 
-	return true, authReasonOK, nil
+// accountFromRow 按列名把一行结果映射为账户；缺省列取零值，enabled 缺省为 true。
+func accountFromRow(fields []pgconn.FieldDescription, values []any, username string) authAccount {
+	acct := authAccount{enabled: true}
+	for i, f := range fields {
+		switch f.Name {
+		case "password_hash":
+			acct.passwordHash = columnString(values[i])
+		case "salt":
+			acct.salt = columnString(values[i])
+		case "enabled":
+			acct.enabled = columnBool(values[i], true)
+		case "scram_verifier":
+			acct.scramVerifier = columnString(values[i])
+		case "clientid":
+			acct.clientID = columnString(values[i])
+		case "clientid_match":
+			acct.clientIDMatch = columnString(values[i])
+		case "valid_from":
+			acct.validFrom = columnTime(values[i])
+		case "valid_until":
+			acct.validUntil = columnTime(values[i])
+		case "allowed_cidrs":
+			cidrs, err := columnPrefixes(values[i])
+			if err != nil {
+				// 配置错误时按拒绝所有来源处理，避免放宽限制。
+				log(mosqLogWarning, "auth-plugin: invalid allowed_cidrs", map[string]any{"username": username, "error": err.Error()})
+				cidrs = []netip.Prefix{}
+			}
+			acct.allowedCIDRs = cidrs
+		case "allowed_protocols":
+			protocols, err := columnProtocols(values[i])
+			if err != nil {
+				log(mosqLogWarning, "auth-plugin: invalid allowed_protocols", map[string]any{"username": username, "error": err.Error()})
+				protocols = []string{}
+			}
+			acct.allowedProtocols = protocols
+		case "allowed_listeners":
+			listeners, err := columnListeners(values[i])
+			if err != nil {
+				log(mosqLogWarning, "auth-plugin: invalid allowed_listeners", map[string]any{"username": username, "error": err.Error()})
+				listeners = []string{}
+			}
+			acct.allowedListeners = listeners
+		case "max_connections":
+			acct.maxConnections = columnInt(values[i])
+		case "is_superuser":
+			acct.acl.superuser = columnBool(values[i], false)
+		case "cert_fingerprint":
+			acct.certFingerprint = columnString(values[i])
+		case "revoked_cert_fingerprints":
+			revoked, err := columnStrings(values[i])
+			if err != nil {
+				// 吊销列表无法解析时按全部吊销处理，避免已吊销的证书通过。
+				log(mosqLogWarning, "auth-plugin: invalid revoked_cert_fingerprints", map[string]any{"username": username, "error": err.Error()})
+				acct.revokedCertsInvalid = true
+			}
+			acct.revokedCertFingerprints = revoked
+		}
+	}
+	return acct
 }
 
-// recordAuthEvent 写入认证事件。
-func recordAuthEvent(info pluginutil.ClientInfo, result, reason string) error {
+// recordAuthResult 按放行/拒绝写入认证事件，写入失败只记录日志。
+func recordAuthResult(info pluginutil.ClientInfo, allow bool, reason string) {
+	recordAuthOutcome(info, allow, reason, false)
+}
+
+// recordAuthOutcome 同 recordAuthResult；superuser=true 时在事件中标记超级用户登录（仅放行时有意义）。
+func recordAuthOutcome(info pluginutil.ClientInfo, allow bool, reason string, superuser bool) {
+	result := authResultFail
+	if allow {
+		result = authResultSuccess
+	}
+	if err := recordAuthEvent(authEvent{info: info, result: result, reason: reason, superuser: allow && superuser}); err != nil {
+		log(mosqLogWarning, "auth-plugin auth event log failed", map[string]any{"error": err.Error()})
+	}
+}
+
+// recordAuthEvent 写入认证事件；ts 取调用时刻。
+func recordAuthEvent(ev authEvent) error {
+	ev.ts = time.Now().UTC()
+	if q := authEvents; q != nil {
+		// 异步模式下不阻塞认证回调；丢弃按采样记录，避免过载时刷屏。
+		if err := q.Enqueue(ev); err != nil {
+			if pluginutil.ShouldSample(&authEventDropCounter, authEventDropLogSampleEvery) {
+				log(mosqLogWarning, "auth-plugin: auth event dropped", map[string]any{"error": err.Error(), "dropped": q.Dropped()})
+			}
+		}
+		return nil
+	}
+
 	ctx := context.Background()
 	cancel := func() {}
 	// 保留 timeout<=0 时“无超时”的旧行为。
@@ -61,21 +260,41 @@ func recordAuthEvent(info pluginutil.ClientInfo, result, reason string) error {
 	}
 	defer cancel()
 
-	p, created, err := poolHolder.Ensure(ctx, pgDSN, authPGPoolOptions)
+	p, err := poolHolder.Ensure(ctx, pluginutil.PGPrimary)
 	if err != nil {
 		return err
 	}
-	if created {
-		log(mosqLogInfo, "auth-plugin: postgres pool connected", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN)})
-	}
-	_, err = p.Exec(ctx, insertAuthEventSQL,
-		time.Now().UTC(),
-		result,
-		reason,
-		pluginutil.OptionalString(info.ClientID),
-		pluginutil.OptionalString(info.Username),
-		pluginutil.OptionalString(info.Peer),
-		pluginutil.OptionalString(info.Protocol),
-	)
+	if err := authQueries.Ensure(ctx, p); err != nil {
+		poolHolder.Report(p, err)
+		return err
+	}
+	query, fields, _ := authQueries.Event()
+	_, err = p.Exec(ctx, query, eventArgs(ev, fields)...)
+	poolHolder.Report(p, err)
 	return err
 }
+
+// eventArgs 按 authQuerySet.Event 返回的下标选取事件参数。
+func eventArgs(ev authEvent, fields []int) []any {
+	all := authEventArgs(ev)
+	args := make([]any, len(fields))
+	for i, f := range fields {
+		args[i] = all[f]
+	}
+	return args
+}
+
+// authEventArgs 按文档约定的位置顺序生成事件参数，自定义 SQL 可只使用前 N 个。
+func authEventArgs(ev authEvent) []any {
+	return []any{
+		ev.ts,
+		ev.result,
+		ev.reason,
+		pluginutil.OptionalString(ev.info.ClientID),
+		pluginutil.OptionalString(ev.info.Username),
+		pluginutil.OptionalString(ev.info.Peer),
+		pluginutil.OptionalString(ev.info.Protocol),
+		ev.superuser,
+		pluginutil.OptionalString(tenantOf(ev.info.Username)),
+	}
+}
@@ -17,7 +17,7 @@ func TestDBAuthMissingCreds(t *testing.T) {
 	for _, tc := range tests {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			allow, reason, err := dbAuth(tc.username, tc.password, "c1")
+			allow, reason, _, err := dbAuth(tc.username, tc.password, "c1")
 			if err != nil {
 				t.Fatalf("dbAuth returned unexpected error: %v", err)
 			}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// 交给内建认证（password_file / acl_file）或其它插件处理的规则类型，用于 defer_rules 配置。
+const (
+	deferRuleEmpty  = "empty"
+	deferRulePrefix = "prefix"
+	deferRuleExact  = "exact"
+	deferRuleRegex  = "regex"
+	deferRulePort   = "port"
+
+	// deferRulesNone 表示不交出任何连接，全部由本插件判定。
+	deferRulesNone = "none"
+)
+
+// deferRule 为一条交出规则；value 为前缀、用户名、正则或端口的原始配置。
+type deferRule struct {
+	kind  string
+	value string
+	re    *regexp.Regexp
+	port  int
+}
+
+// defaultDeferRules 为未配置 defer_rules 时的规则：空用户名与 _ 前缀用户交给内建认证。
+var defaultDeferRules = []deferRule{{kind: deferRuleEmpty}, {kind: deferRulePrefix, value: "_"}}
+
+// parseDeferRules 解析逗号分隔的规则列表，条目格式为 empty、prefix:<前缀>、exact:<用户名>、
+// regex:<正则>、port:<监听端口>；none 表示不交出任何连接。正则中不能包含逗号。
+func parseDeferRules(v string) ([]deferRule, error) {
+	if strings.EqualFold(strings.TrimSpace(v), deferRulesNone) {
+		return []deferRule{}, nil
+	}
+	var rules []deferRule
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kind, value, _ := strings.Cut(item, ":")
+		r := deferRule{kind: strings.ToLower(strings.TrimSpace(kind)), value: value}
+		switch r.kind {
+		case deferRuleEmpty:
+			if value != "" {
+				return nil, fmt.Errorf("defer rule %q takes no value", item)
+			}
+		case deferRulePrefix, deferRuleExact:
+			if value == "" {
+				return nil, fmt.Errorf("defer rule %q requires a value", item)
+			}
+		case deferRuleRegex:
+			re, err := regexp.Compile(value)
+			if err != nil || value == "" {
+				return nil, fmt.Errorf("invalid defer regex %q", value)
+			}
+			r.re = re
+		case deferRulePort:
+			port, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || port <= 0 || port > 65535 {
+				return nil, fmt.Errorf("invalid defer port %q", value)
+			}
+			r.port = port
+		default:
+			return nil, fmt.Errorf("unknown defer rule %q", item)
+		}
+		rules = append(rules, r)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("empty defer_rules")
+	}
+	return rules, nil
+}
+
+// deferRulesString 将规则转回配置字符串，用于日志。
+func deferRulesString(rules []deferRule) string {
+	if len(rules) == 0 {
+		return deferRulesNone
+	}
+	items := make([]string, 0, len(rules))
+	for _, r := range rules {
+		if r.kind == deferRuleEmpty {
+			items = append(items, r.kind)
+			continue
+		}
+		items = append(items, r.kind+":"+r.value)
+	}
+	return strings.Join(items, ",")
+}
+
+// matches 判断连接是否命中规则；空用户名只由 empty 规则命中，端口未知（0）时不命中 port 规则。
+func (r deferRule) matches(info pluginutil.ClientInfo) bool {
+	switch r.kind {
+	case deferRuleEmpty:
+		return info.Username == ""
+	case deferRulePort:
+		return info.ListenerPort != 0 && info.ListenerPort == r.port
+	}
+	if info.Username == "" {
+		return false
+	}
+	switch r.kind {
+	case deferRulePrefix:
+		return strings.HasPrefix(info.Username, r.value)
+	case deferRuleExact:
+		return info.Username == r.value
+	case deferRuleRegex:
+		return r.re.MatchString(info.Username)
+	}
+	return false
+}
+
+// matchDeferRule 返回第一条命中的规则。
+func matchDeferRule(rules []deferRule, info pluginutil.ClientInfo) (deferRule, bool) {
+	for _, r := range rules {
+		if r.matches(info) {
+			return r, true
+		}
+	}
+	return deferRule{}, false
+}
+
+// shouldDefer 判断认证请求是否交给内建认证或其它插件；defer_record=true 时记录 defer 事件，
+// reason 为 defer_<规则类型>。ACL_CHECK 直接使用 matchDeferRule，不记录事件。
+func shouldDefer(info pluginutil.ClientInfo) bool {
+	r, ok := matchDeferRule(deferRules, info)
+	if !ok {
+		return false
+	}
+	if deferRecord {
+		if err := recordAuthEvent(authEvent{info: info, result: authResultDefer, reason: "defer_" + r.kind}); err != nil {
+			log(mosqLogWarning, "auth-plugin auth event log failed", map[string]any{"error": err.Error()})
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func TestParseDeferRules(t *testing.T) {
+	rules, err := parseDeferRules(" empty, prefix:_ ,exact:ops-console, regex:^svc-[0-9]+$, port:1884")
+	if err != nil {
+		t.Fatalf("parseDeferRules: %v", err)
+	}
+	if got, want := deferRulesString(rules), "empty,prefix:_,exact:ops-console,regex:^svc-[0-9]+$,port:1884"; got != want {
+		t.Fatalf("deferRulesString = %q, want %q", got, want)
+	}
+	if rules, err := parseDeferRules("None"); err != nil || len(rules) != 0 {
+		t.Fatalf("none = %v, %v", rules, err)
+	}
+	for _, v := range []string{"", "prefix:", "exact", "empty:x", "regex:(", "port:0", "port:http", "suffix:_"} {
+		if _, err := parseDeferRules(v); err == nil {
+			t.Errorf("parseDeferRules(%q) should fail", v)
+		}
+	}
+}
+
+func TestMatchDeferRule(t *testing.T) {
+	rules, err := parseDeferRules("prefix:_,exact:ops-console,regex:^svc-[0-9]+$,port:1884")
+	if err != nil {
+		t.Fatalf("parseDeferRules: %v", err)
+	}
+	cases := []struct {
+		name string
+		info pluginutil.ClientInfo
+		kind string
+	}{
+		{"prefix", pluginutil.ClientInfo{Username: "_ops"}, deferRulePrefix},
+		{"exact", pluginutil.ClientInfo{Username: "ops-console"}, deferRuleExact},
+		{"exact is not prefix", pluginutil.ClientInfo{Username: "ops-console-2"}, ""},
+		{"regex", pluginutil.ClientInfo{Username: "svc-42"}, deferRuleRegex},
+		{"regex anchored", pluginutil.ClientInfo{Username: "svc-42a"}, ""},
+		{"port", pluginutil.ClientInfo{Username: "dev", ListenerPort: 1884}, deferRulePort},
+		{"other port", pluginutil.ClientInfo{Username: "dev", ListenerPort: 1883}, ""},
+		{"empty without rule", pluginutil.ClientInfo{}, ""},
+	}
+	for _, tc := range cases {
+		r, ok := matchDeferRule(rules, tc.info)
+		if ok != (tc.kind != "") || r.kind != tc.kind {
+			t.Errorf("%s: matched %q, %v; want %q", tc.name, r.kind, ok, tc.kind)
+		}
+	}
+	if _, ok := matchDeferRule(defaultDeferRules, pluginutil.ClientInfo{}); !ok {
+		t.Error("default rules should defer empty username")
+	}
+	if _, ok := matchDeferRule(defaultDeferRules, pluginutil.ClientInfo{Username: "dev"}); ok {
+		t.Error("default rules should not defer regular username")
+	}
+}
+
+func TestShouldDeferRecord(t *testing.T) {
+	var rec recordedBatches
+	authEvents = startAuthEventQueue(authEventQueueConfig{size: 16, batchSize: 16, flushInterval: time.Hour}, rec.write)
+	defer func() { deferRecord = false }()
+
+	if !shouldDefer(pluginutil.ClientInfo{Username: "_silent"}) {
+		t.Fatal("_ prefix should be deferred")
+	}
+	deferRecord = true
+	if !shouldDefer(pluginutil.ClientInfo{Username: "_ops", ClientID: "c1"}) {
+		t.Fatal("_ prefix should be deferred")
+	}
+	if shouldDefer(pluginutil.ClientInfo{Username: "dev"}) {
+		t.Fatal("regular username should not be deferred")
+	}
+
+	stopAuthEventQueue()
+	var got []authEvent
+	for _, b := range rec.batches {
+		got = append(got, b...)
+	}
+	if len(got) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(got))
+	}
+	ev := got[0]
+	if ev.result != authResultDefer || ev.reason != "defer_prefix" || !reflect.DeepEqual(ev.info, pluginutil.ClientInfo{Username: "_ops", ClientID: "c1"}) {
+		t.Fatalf("event = %+v", ev)
+	}
+}
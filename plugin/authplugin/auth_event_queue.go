@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+const (
+	defaultAuthEventBatchSize      = 100
+	defaultAuthEventFlushInterval  = 200 * time.Millisecond
+	defaultAuthEventEnqueueTimeout = 100 * time.Millisecond
+	authEventDropLogSampleEvery    = uint64(128)
+)
+
+// authEventFailMode 控制事件队列满时的处理策略。
+type authEventFailMode int
+
+const (
+	// authEventFailDrop 队列满时直接丢弃事件，不阻塞认证回调。
+	authEventFailDrop authEventFailMode = iota
+	// authEventFailBlock 队列满时最多等待 enqueue 超时，仍失败再丢弃。
+	authEventFailBlock
+)
+
+var (
+	errAuthEventQueueStopped = errors.New("auth-plugin: event queue stopped")
+	errAuthEventQueueFull    = errors.New("auth-plugin: event queue full")
+	errAuthEventEnqueueWait  = errors.New("auth-plugin: event enqueue timeout")
+)
+
+// parseAuthEventFailMode 解析 auth_event_fail_mode。
+func parseAuthEventFailMode(v string) (authEventFailMode, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "drop":
+		return authEventFailDrop, true
+	case "block":
+		return authEventFailBlock, true
+	default:
+		return authEventFailDrop, false
+	}
+}
+
+// authEventFailModeString 将失败策略转回配置字符串。
+func authEventFailModeString(mode authEventFailMode) string {
+	if mode == authEventFailBlock {
+		return "block"
+	}
+	return "drop"
+}
+
+// authEvent 为待写入的认证事件；ts 在产生时确定，批量写入不改变事件时间。
+type authEvent struct {
+	ts     time.Time
+	info   pluginutil.ClientInfo
+	result string
+	reason string
+	// superuser 标记超级用户登录。
+	superuser bool
+}
+
+// authEventQueueConfig 为事件队列参数，来自 auth_event_* 配置项。
+type authEventQueueConfig struct {
+	size           int
+	batchSize      int
+	flushInterval  time.Duration
+	failMode       authEventFailMode
+	enqueueTimeout time.Duration
+}
+
+// authEventQueue 是有界的事件队列，后台协程按批量大小或刷新间隔写库。
+type authEventQueue struct {
+	cfg   authEventQueueConfig
+	write func([]authEvent) error
+
+	ch     chan authEvent
+	stopCh chan struct{}
+	doneCh chan struct{}
+	once   sync.Once
+
+	dropped uint64
+}
+
+// startAuthEventQueue 创建队列并启动写库协程；write 在注入时绑定，便于测试替换。
+func startAuthEventQueue(cfg authEventQueueConfig, write func([]authEvent) error) *authEventQueue {
+	if cfg.batchSize <= 0 {
+		cfg.batchSize = defaultAuthEventBatchSize
+	}
+	if cfg.flushInterval <= 0 {
+		cfg.flushInterval = defaultAuthEventFlushInterval
+	}
+	q := &authEventQueue{
+		cfg:    cfg,
+		write:  write,
+		ch:     make(chan authEvent, cfg.size),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Enqueue 按失败策略写入队列；失败时累计丢弃计数并返回原因。
+func (q *authEventQueue) Enqueue(ev authEvent) error {
+	select {
+	case <-q.stopCh:
+		return errAuthEventQueueStopped
+	default:
+	}
+
+	select {
+	case q.ch <- ev:
+		return nil
+	default:
+	}
+	if q.cfg.failMode != authEventFailBlock || q.cfg.enqueueTimeout <= 0 {
+		atomic.AddUint64(&q.dropped, 1)
+		return errAuthEventQueueFull
+	}
+	timer := time.NewTimer(q.cfg.enqueueTimeout)
+	defer timer.Stop()
+	select {
+	case q.ch <- ev:
+		return nil
+	case <-q.stopCh:
+		return errAuthEventQueueStopped
+	case <-timer.C:
+		atomic.AddUint64(&q.dropped, 1)
+		return errAuthEventEnqueueWait
+	}
+}
+
+// Dropped 返回累计丢弃的事件数。
+func (q *authEventQueue) Dropped() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// Stop 停止接收新事件，写完队列中剩余事件后返回。
+func (q *authEventQueue) Stop() {
+	q.once.Do(func() { close(q.stopCh) })
+	<-q.doneCh
+}
+
+func (q *authEventQueue) run() {
+	defer close(q.doneCh)
+	ticker := time.NewTicker(q.cfg.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]authEvent, 0, q.cfg.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := q.write(batch); err != nil {
+			log(mosqLogWarning, "auth-plugin: flush auth events failed", map[string]any{"count": len(batch), "error": err.Error()})
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case ev := <-q.ch:
+			batch = append(batch, ev)
+			if len(batch) >= q.cfg.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-q.stopCh:
+			// 退出前排空队列，保证 cleanup 时已入队的事件都会写库。
+			for {
+				select {
+				case ev := <-q.ch:
+					batch = append(batch, ev)
+					if len(batch) >= q.cfg.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeAuthEvents 批量写入事件：内置 SQL 使用 COPY，自定义 auth_event_query 使用 pgx.Batch 一次往返发送。
+func writeAuthEvents(events []authEvent) error {
+	ctx := context.Background()
+	cancel := func() {}
+	// 保留 timeout<=0 时“无超时”的旧行为。
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	defer cancel()
+
+	p, err := poolHolder.Ensure(ctx, pluginutil.PGPrimary)
+	if err != nil {
+		return err
+	}
+	if err := authQueries.Ensure(ctx, p); err != nil {
+		poolHolder.Report(p, err)
+		return err
+	}
+	query, fields, copyColumns := authQueries.Event()
+	if copyColumns != nil {
+		_, err = p.CopyFrom(ctx, pgx.Identifier{"client_auth_events"}, copyColumns, pgx.CopyFromSlice(len(events), func(i int) ([]any, error) {
+			return eventArgs(events[i], fields), nil
+		}))
+	} else {
+		b := &pgx.Batch{}
+		for _, ev := range events {
+			b.Queue(query, eventArgs(ev, fields)...)
+		}
+		err = p.SendBatch(ctx, b).Close()
+	}
+	poolHolder.Report(p, err)
+	return err
+}
+
+// stopAuthEventQueue 写完剩余事件并停止队列；插件重载与退出时调用。
+func stopAuthEventQueue() {
+	if authEvents == nil {
+		return
+	}
+	authEvents.Stop()
+	if dropped := authEvents.Dropped(); dropped > 0 {
+		log(mosqLogWarning, "auth-plugin: auth events dropped", map[string]any{"dropped": dropped})
+	}
+	authEvents = nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedBatches struct {
+	mu      sync.Mutex
+	batches [][]authEvent
+}
+
+func (r *recordedBatches) write(events []authEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, append([]authEvent(nil), events...))
+	return nil
+}
+
+func (r *recordedBatches) total() (batches, events int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, b := range r.batches {
+		events += len(b)
+	}
+	return len(r.batches), events
+}
+
+func TestAuthEventQueueBatchesAndFlushesOnStop(t *testing.T) {
+	var rec recordedBatches
+	q := startAuthEventQueue(authEventQueueConfig{size: 100, batchSize: 4, flushInterval: time.Hour}, rec.write)
+	for i := 0; i < 10; i++ {
+		if err := q.Enqueue(authEvent{reason: authReasonOK}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	q.Stop()
+	batches, events := rec.total()
+	if events != 10 {
+		t.Fatalf("all queued events should be flushed on stop, got %d", events)
+	}
+	if batches != 3 {
+		t.Fatalf("expected 3 batches (4+4+2), got %d", batches)
+	}
+	if err := q.Enqueue(authEvent{}); !errors.Is(err, errAuthEventQueueStopped) {
+		t.Fatalf("Enqueue after stop = %v", err)
+	}
+}
+
+func TestAuthEventQueueFlushInterval(t *testing.T) {
+	var rec recordedBatches
+	q := startAuthEventQueue(authEventQueueConfig{size: 10, batchSize: 100, flushInterval: 10 * time.Millisecond}, rec.write)
+	defer q.Stop()
+	if err := q.Enqueue(authEvent{}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, events := rec.total(); events == 1 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("event was not flushed by interval")
+}
+
+func TestAuthEventQueueFailModes(t *testing.T) {
+	release := make(chan struct{})
+	blockingWrite := func([]authEvent) error {
+		<-release
+		return nil
+	}
+
+	for _, tc := range []struct {
+		mode authEventFailMode
+		want error
+	}{
+		{authEventFailDrop, errAuthEventQueueFull},
+		{authEventFailBlock, errAuthEventEnqueueWait},
+	} {
+		q := startAuthEventQueue(authEventQueueConfig{
+			size:           1,
+			batchSize:      1,
+			flushInterval:  time.Hour,
+			failMode:       tc.mode,
+			enqueueTimeout: 10 * time.Millisecond,
+		}, blockingWrite)
+		// 第一条被写库协程取走并阻塞，第二条占满队列，第三条触发失败策略。
+		_ = q.Enqueue(authEvent{})
+		deadline := time.Now().Add(2 * time.Second)
+		for len(q.ch) != 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if err := q.Enqueue(authEvent{}); err != nil {
+			t.Fatalf("%s: second Enqueue: %v", authEventFailModeString(tc.mode), err)
+		}
+		if err := q.Enqueue(authEvent{}); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: Enqueue on full queue = %v, want %v", authEventFailModeString(tc.mode), err, tc.want)
+		}
+		if q.Dropped() != 1 {
+			t.Fatalf("%s: dropped=%d, want 1", authEventFailModeString(tc.mode), q.Dropped())
+		}
+		release <- struct{}{}
+		release <- struct{}{}
+		q.Stop()
+	}
+}
+
+func TestParseAuthEventFailMode(t *testing.T) {
+	if mode, ok := parseAuthEventFailMode(" Block "); !ok || mode != authEventFailBlock {
+		t.Fatalf("parse block = %v, %v", mode, ok)
+	}
+	if mode, ok := parseAuthEventFailMode("drop"); !ok || mode != authEventFailDrop {
+		t.Fatalf("parse drop = %v, %v", mode, ok)
+	}
+	if _, ok := parseAuthEventFailMode("disconnect"); ok {
+		t.Fatalf("disconnect is not a valid auth event fail mode")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// authFileStore 为本地账户文件中的账户（通常是服务账号），插件加载时读入，修改后需重载插件。
+type authFileStore struct {
+	path  string
+	users map[string]string
+}
+
+// loadAuthFile 读取账户文件。
+func loadAuthFile(path string) (*authFileStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	users, err := parseAuthFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &authFileStore{path: path, users: users}, nil
+}
+
+// parseAuthFile 解析 "username:password_hash" 行；空行与 # 开头的行忽略。
+// 文件中没有盐字段，哈希必须是带前缀的自描述格式（bcrypt/argon2id/pbkdf2-sha256/sha256）。
+func parseAuthFile(r io.Reader) (map[string]string, error) {
+	users := map[string]string{}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(text, ":")
+		username, hash = strings.TrimSpace(username), strings.TrimSpace(hash)
+		if !ok || username == "" || hash == "" {
+			return nil, fmt.Errorf("line %d: expected username:password_hash", line)
+		}
+		if algo := pluginutil.HashAlgorithm(hash); algo == "" || algo == pluginutil.HashAlgoLegacy {
+			return nil, fmt.Errorf("line %d: unsupported password hash for %q", line, username)
+		}
+		if _, dup := users[username]; dup {
+			return nil, fmt.Errorf("line %d: duplicate username %q", line, username)
+		}
+		users[username] = hash
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// fileAuthenticator 按账户文件校验密码；文件中没有的用户交给下一个后端。
+type fileAuthenticator struct {
+	store *authFileStore
+}
+
+func (fileAuthenticator) Name() string { return authBackendFile }
+
+func (a fileAuthenticator) Authenticate(req *authRequest) authOutcome {
+	hash, ok := a.store.users[req.info.Username]
+	if !ok {
+		return authOutcome{decision: authNext, reason: authReasonUserNotFound}
+	}
+	if req.password == "" {
+		return authOutcome{decision: authDeny, reason: authReasonMissingCreds}
+	}
+	match, err := pluginutil.VerifyPassword(req.password, hash, "")
+	if err != nil {
+		log(mosqLogWarning, "auth-plugin: unsupported password hash", map[string]any{"username": req.info.Username, "auth_file": a.store.path, "error": err.Error()})
+		return authOutcome{decision: authDeny, reason: authReasonUnsupportedHash}
+	}
+	if !match {
+		return authOutcome{decision: authDeny, reason: authReasonInvalidPassword}
+	}
+	return authOutcome{decision: authAllow, reason: authReasonFileOK}
+}
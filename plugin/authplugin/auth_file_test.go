@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func TestParseAuthFile(t *testing.T) {
+	users, err := parseAuthFile(strings.NewReader("# service accounts\n\nsvc-a:$sha256$salt$abc\n  svc-b : $2b$10$xyz \n"))
+	if err != nil || len(users) != 2 || users["svc-b"] != "$2b$10$xyz" {
+		t.Fatalf("parseAuthFile = %v, %v", users, err)
+	}
+	for _, bad := range []string{
+		"svc-a",
+		":$sha256$salt$abc",
+		"svc-a:",
+		"svc-a:deadbeef",
+		"svc-a:$md5$abc",
+		"svc-a:$sha256$s$1\nsvc-a:$sha256$s$2",
+	} {
+		if _, err := parseAuthFile(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+}
+
+func TestFileAuthenticator(t *testing.T) {
+	hash, err := pluginutil.HashPassword(pluginutil.HashAlgoSHA256, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := fileAuthenticator{store: &authFileStore{users: map[string]string{"svc": hash}}}
+	cases := []struct {
+		user, password string
+		decision       authDecision
+		reason         string
+	}{
+		{"svc", "secret", authAllow, authReasonFileOK},
+		{"svc", "wrong", authDeny, authReasonInvalidPassword},
+		{"svc", "", authDeny, authReasonMissingCreds},
+		{"device-1", "secret", authNext, authReasonUserNotFound},
+	}
+	for _, tc := range cases {
+		out := a.Authenticate(&authRequest{info: pluginutil.ClientInfo{Username: tc.user}, password: tc.password})
+		if out.decision != tc.decision || out.reason != tc.reason {
+			t.Errorf("%s/%q = %v %q, want %v %q", tc.user, tc.password, out.decision, out.reason, tc.decision, tc.reason)
+		}
+	}
+}
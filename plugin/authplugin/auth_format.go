@@ -0,0 +1,56 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// formatPolicy 为 clientid / 用户名的格式约束，零值表示不限制。
+type formatPolicy struct {
+	// pattern 整体锚定，需完整匹配；raw 为原始配置，用于日志。
+	pattern   *regexp.Regexp
+	raw       string
+	maxLength int
+	// forbidden 中的任一字符出现即视为不合法。
+	forbidden string
+}
+
+// setPattern 编译正则；空串表示取消正则约束。
+func (p *formatPolicy) setPattern(v string) bool {
+	if v == "" {
+		p.pattern, p.raw = nil, ""
+		return true
+	}
+	re, err := regexp.Compile("^(?:" + v + ")$")
+	if err != nil {
+		return false
+	}
+	p.pattern, p.raw = re, v
+	return true
+}
+
+// Valid 判断取值是否满足约束；长度按字符计。
+func (p formatPolicy) Valid(v string) bool {
+	if p.maxLength > 0 && utf8.RuneCountInString(v) > p.maxLength {
+		return false
+	}
+	if p.forbidden != "" && strings.ContainsAny(v, p.forbidden) {
+		return false
+	}
+	return p.pattern == nil || p.pattern.MatchString(v)
+}
+
+// checkClientFormat 在访问数据库之前检查 clientid 与用户名格式，不合法时返回拒绝原因。
+// 空用户名交给认证链判定（missing_credentials），不在这里拒绝。
+func checkClientFormat(info pluginutil.ClientInfo) string {
+	if !clientIDFormat.Valid(info.ClientID) {
+		return authReasonInvalidClientID
+	}
+	if info.Username != "" && !usernameFormat.Valid(info.Username) {
+		return authReasonInvalidUsername
+	}
+	return ""
+}
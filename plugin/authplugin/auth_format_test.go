@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func TestFormatPolicyValid(t *testing.T) {
+	var p formatPolicy
+	if !p.Valid("any/+#thing") {
+		t.Fatal("zero policy should accept anything")
+	}
+	if !p.setPattern("[a-z0-9-]+") {
+		t.Fatal("setPattern failed")
+	}
+	p.maxLength = 8
+	p.forbidden = "+#/"
+	cases := map[string]bool{
+		"dev-01":    true,
+		"dev-0001":  true,
+		"dev-00001": false, // 超过 8 个字符
+		"dev/01":    false,
+		"dev+":      false,
+		"Dev-01":    false, // 正则整体锚定
+		"":          false,
+	}
+	for v, want := range cases {
+		if got := p.Valid(v); got != want {
+			t.Errorf("Valid(%q) = %v, want %v", v, got, want)
+		}
+	}
+	if p.setPattern("(") {
+		t.Fatal("invalid pattern should be rejected")
+	}
+	if p.raw != "[a-z0-9-]+" {
+		t.Fatalf("invalid pattern should keep previous one, got %q", p.raw)
+	}
+	if !p.setPattern("") || p.pattern != nil {
+		t.Fatal("empty pattern should clear the constraint")
+	}
+}
+
+func TestCheckClientFormat(t *testing.T) {
+	defer func() { clientIDFormat, usernameFormat = formatPolicy{}, formatPolicy{} }()
+	clientIDFormat = formatPolicy{forbidden: "+#/"}
+	usernameFormat = formatPolicy{maxLength: 4}
+
+	cases := []struct {
+		info pluginutil.ClientInfo
+		want string
+	}{
+		{pluginutil.ClientInfo{ClientID: "c1", Username: "dev"}, ""},
+		{pluginutil.ClientInfo{ClientID: "c/1", Username: "dev"}, authReasonInvalidClientID},
+		{pluginutil.ClientInfo{ClientID: "c1", Username: "device"}, authReasonInvalidUsername},
+		{pluginutil.ClientInfo{ClientID: "c1"}, ""},
+	}
+	for _, tc := range cases {
+		if got := checkClientFormat(tc.info); got != tc.want {
+			t.Errorf("checkClientFormat(%+v) = %q, want %q", tc.info, got, tc.want)
+		}
+	}
+}
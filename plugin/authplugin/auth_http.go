@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+const (
+	defaultHTTPAuthMaxConns    = 16
+	defaultHTTPAuthCacheTTL    = 30 * time.Second
+	defaultHTTPAuthCacheNegTTL = 5 * time.Second
+	httpAuthMaxResponseBytes   = 64 << 10
+	httpAuthIdleConnTimeout    = 90 * time.Second
+
+	httpAuthDecisionAllow = "allow"
+	httpAuthDecisionDeny  = "deny"
+	httpAuthDecisionDefer = "defer"
+)
+
+// httpAuthConfig 为 HTTP 认证后端参数，来自 http_auth_* 配置项；url 为空表示未启用。
+type httpAuthConfig struct {
+	url      string
+	timeout  time.Duration
+	maxConns int
+	// cacheSize=0 表示不缓存响应。
+	cacheSize   int
+	cacheTTL    time.Duration
+	cacheNegTTL time.Duration
+}
+
+func defaultHTTPAuthConfig() httpAuthConfig {
+	return httpAuthConfig{
+		maxConns:    defaultHTTPAuthMaxConns,
+		cacheTTL:    defaultHTTPAuthCacheTTL,
+		cacheNegTTL: defaultHTTPAuthCacheNegTTL,
+	}
+}
+
+// httpAuthRequest 为 POST 给认证服务的请求体。
+type httpAuthRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	ClientID string `json:"client_id"`
+	Peer     string `json:"peer"`
+	Protocol string `json:"protocol"`
+}
+
+// httpAuthResponse 为认证服务的响应体；acl 格式与 jwt_acl_claim 相同。
+type httpAuthResponse struct {
+	Result    string `json:"result"`
+	Superuser bool   `json:"superuser"`
+	ACL       any    `json:"acl"`
+}
+
+// httpAuthResult 为一次 HTTP 认证的判定；decision 为 allow/deny/defer。
+type httpAuthResult struct {
+	decision string
+	acl      connACL
+}
+
+// httpAuthBackend 通过 HTTP POST 把认证委托给外部服务，连接复用由 http.Transport 负责。
+type httpAuthBackend struct {
+	cfg       httpAuthConfig
+	client    *http.Client
+	transport *http.Transport
+	// cache 复用认证缓存结构：allow 对应 http_ok，其余按 reason 区分 deny/defer。
+	cache *authCache
+}
+
+func newHTTPAuthBackend(cfg httpAuthConfig) *httpAuthBackend {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.MaxIdleConns = cfg.maxConns
+	tr.MaxIdleConnsPerHost = cfg.maxConns
+	tr.MaxConnsPerHost = cfg.maxConns
+	tr.IdleConnTimeout = httpAuthIdleConnTimeout
+	b := &httpAuthBackend{
+		cfg:       cfg,
+		client:    &http.Client{Transport: tr},
+		transport: tr,
+	}
+	if cfg.cacheSize > 0 {
+		b.cache = newAuthCache(cfg.cacheSize, cfg.cacheTTL, cfg.cacheNegTTL)
+	}
+	return b
+}
+
+// Authenticate 返回认证服务的判定；网络错误、非 2xx 与无法解析的响应返回 error，不写入缓存。
+func (b *httpAuthBackend) Authenticate(info pluginutil.ClientInfo, password string, now time.Time) (httpAuthResult, error) {
+	var key authCacheKey
+	var gen uint64
+	if b.cache != nil {
+		key = b.cache.Key(info.Username, info.ClientID, password)
+		if allow, reason, attrs, ok := b.cache.Get(key, now); ok {
+			return httpAuthResultFromCache(allow, reason, attrs), nil
+		}
+		gen = b.cache.Generation()
+	}
+
+	res, err := b.post(info, password)
+	if err != nil {
+		return httpAuthResult{}, err
+	}
+	if b.cache != nil {
+		reason := authReasonHTTPDenied
+		switch res.decision {
+		case httpAuthDecisionAllow:
+			reason = authReasonHTTPOK
+		case httpAuthDecisionDefer:
+			reason = authReasonHTTPDefer
+		}
+		b.cache.Put(key, res.decision == httpAuthDecisionAllow, reason, accountAttrs{acl: res.acl}, gen, now)
+	}
+	return res, nil
+}
+
+func httpAuthResultFromCache(allow bool, reason string, attrs accountAttrs) httpAuthResult {
+	switch {
+	case allow:
+		return httpAuthResult{decision: httpAuthDecisionAllow, acl: attrs.acl}
+	case reason == authReasonHTTPDefer:
+		return httpAuthResult{decision: httpAuthDecisionDefer}
+	default:
+		return httpAuthResult{decision: httpAuthDecisionDeny}
+	}
+}
+
+func (b *httpAuthBackend) post(info pluginutil.ClientInfo, password string) (httpAuthResult, error) {
+	body, err := json.Marshal(httpAuthRequest{
+		Username: info.Username,
+		Password: password,
+		ClientID: info.ClientID,
+		Peer:     info.Peer,
+		Protocol: info.Protocol,
+	})
+	if err != nil {
+		return httpAuthResult{}, err
+	}
+
+	ctx := context.Background()
+	cancel := func() {}
+	if b.cfg.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), b.cfg.timeout)
+	}
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.cfg.url, bytes.NewReader(body))
+	if err != nil {
+		return httpAuthResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return httpAuthResult{}, err
+	}
+	defer resp.Body.Close()
+	// 读完响应体才能复用连接；超限部分丢弃。
+	data, err := io.ReadAll(io.LimitReader(resp.Body, httpAuthMaxResponseBytes))
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return httpAuthResult{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return httpAuthResult{}, fmt.Errorf("http auth: unexpected status %d", resp.StatusCode)
+	}
+
+	var out httpAuthResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return httpAuthResult{}, fmt.Errorf("http auth: decode response: %w", err)
+	}
+	switch decision := strings.ToLower(strings.TrimSpace(out.Result)); decision {
+	case httpAuthDecisionAllow:
+		rules, err := parseACLGrant(out.ACL)
+		if err != nil {
+			return httpAuthResult{}, fmt.Errorf("http auth: %w", err)
+		}
+		return httpAuthResult{decision: decision, acl: connACL{rules: rules, superuser: out.Superuser}}, nil
+	case httpAuthDecisionDeny, httpAuthDecisionDefer:
+		return httpAuthResult{decision: decision}, nil
+	default:
+		return httpAuthResult{}, fmt.Errorf("http auth: invalid result %q", out.Result)
+	}
+}
+
+// Close 关闭空闲连接，插件重载与退出时调用。
+func (b *httpAuthBackend) Close() {
+	b.transport.CloseIdleConnections()
+}
+
+// httpAuthenticator 调用 HTTP 认证服务；服务返回 defer 时交给下一个后端。
+type httpAuthenticator struct {
+	backend *httpAuthBackend
+}
+
+func (httpAuthenticator) Name() string { return authBackendHTTP }
+
+func (a httpAuthenticator) Authenticate(req *authRequest) authOutcome {
+	res, err := a.backend.Authenticate(req.info, req.password, req.now)
+	if err != nil {
+		return authOutcome{decision: authDeny, reason: authReasonHTTPError, err: err, failOpenReason: authReasonHTTPErrorFailOpen}
+	}
+	switch res.decision {
+	case httpAuthDecisionAllow:
+		return authOutcome{decision: authAllow, reason: authReasonHTTPOK, attrs: accountAttrs{acl: res.acl}}
+	case httpAuthDecisionDefer:
+		return authOutcome{decision: authNext}
+	default:
+		return authOutcome{decision: authDeny, reason: authReasonHTTPDenied}
+	}
+}
+
+// stopHTTPAuth 释放 HTTP 认证后端。
+func stopHTTPAuth() {
+	if httpAuth == nil {
+		return
+	}
+	httpAuth.Close()
+	httpAuth = nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// newHTTPAuthTestServer 按请求中的用户名返回预设响应，并统计请求次数。
+func newHTTPAuthTestServer(t *testing.T, responses map[string]string) (*httptest.Server, *int64) {
+	t.Helper()
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var req httpAuthRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, ok := responses[req.Username]
+		if !ok {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		if req.Password != "pwd" || req.ClientID != "c1" || req.Peer != "10.0.0.1" {
+			http.Error(w, "unexpected payload", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestHTTPAuthBackendDecisions(t *testing.T) {
+	srv, _ := newHTTPAuthTestServer(t, map[string]string{
+		"alice":   `{"result":"allow","acl":{"pub":["v1/d/%c/up"],"sub":["v1/d/%c/cmd/#"]}}`,
+		"root":    `{"result":"allow","superuser":true}`,
+		"bob":     `{"result":"deny"}`,
+		"carol":   `{"result":"DEFER"}`,
+		"badacl":  `{"result":"allow","acl":{"pub":"v1/#"}}`,
+		"garbage": `not json`,
+		"unknown": `{"result":"maybe"}`,
+	})
+	cfg := defaultHTTPAuthConfig()
+	cfg.url = srv.URL
+	cfg.timeout = time.Second
+	b := newHTTPAuthBackend(cfg)
+	defer b.Close()
+	now := time.Now()
+	info := func(user string) pluginutil.ClientInfo {
+		return pluginutil.ClientInfo{Username: user, ClientID: "c1", Peer: "10.0.0.1"}
+	}
+
+	res, err := b.Authenticate(info("alice"), "pwd", now)
+	if err != nil || res.decision != httpAuthDecisionAllow || len(res.acl.rules) != 2 || res.acl.superuser {
+		t.Fatalf("alice = %+v, %v", res, err)
+	}
+	if allow, _ := evaluateACL(res.acl.rules, info("alice"), "v1/d/c1/up", mosqACLWrite); !allow {
+		t.Fatalf("granted acl should allow own topic")
+	}
+	if res, err := b.Authenticate(info("root"), "pwd", now); err != nil || !res.acl.superuser || res.acl.rules != nil {
+		t.Fatalf("root = %+v, %v", res, err)
+	}
+	if res, err := b.Authenticate(info("bob"), "pwd", now); err != nil || res.decision != httpAuthDecisionDeny {
+		t.Fatalf("bob = %+v, %v", res, err)
+	}
+	if res, err := b.Authenticate(info("carol"), "pwd", now); err != nil || res.decision != httpAuthDecisionDefer {
+		t.Fatalf("carol = %+v, %v", res, err)
+	}
+	for _, user := range []string{"badacl", "garbage", "unknown", "nobody"} {
+		if _, err := b.Authenticate(info(user), "pwd", now); err == nil {
+			t.Errorf("%s should return an error", user)
+		}
+	}
+}
+
+func TestHTTPAuthBackendCache(t *testing.T) {
+	srv, hits := newHTTPAuthTestServer(t, map[string]string{
+		"alice": `{"result":"allow","superuser":true}`,
+		"bob":   `{"result":"deny"}`,
+		"carol": `{"result":"defer"}`,
+	})
+	cfg := defaultHTTPAuthConfig()
+	cfg.url = srv.URL
+	cfg.cacheSize = 8
+	b := newHTTPAuthBackend(cfg)
+	defer b.Close()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		for _, user := range []string{"alice", "bob", "carol"} {
+			if _, err := b.Authenticate(pluginutil.ClientInfo{Username: user, ClientID: "c1", Peer: "10.0.0.1"}, "pwd", now); err != nil {
+				t.Fatalf("%s: %v", user, err)
+			}
+		}
+	}
+	if n := atomic.LoadInt64(hits); n != 3 {
+		t.Fatalf("server hits = %d, want 3 (one per user)", n)
+	}
+	res, _ := b.Authenticate(pluginutil.ClientInfo{Username: "alice", ClientID: "c1", Peer: "10.0.0.1"}, "pwd", now)
+	if res.decision != httpAuthDecisionAllow || !res.acl.superuser {
+		t.Fatalf("cached alice = %+v", res)
+	}
+	res, _ = b.Authenticate(pluginutil.ClientInfo{Username: "carol", ClientID: "c1", Peer: "10.0.0.1"}, "pwd", now)
+	if res.decision != httpAuthDecisionDefer {
+		t.Fatalf("cached carol = %+v", res)
+	}
+
+	// 负向结果按 negative TTL 过期后重新请求。
+	if _, err := b.Authenticate(pluginutil.ClientInfo{Username: "bob", ClientID: "c1", Peer: "10.0.0.1"}, "pwd", now.Add(cfg.cacheNegTTL)); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(hits); n != 4 {
+		t.Fatalf("server hits = %d, want 4 after negative expiry", n)
+	}
+}
+
+func TestHTTPAuthBackendTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	cfg := defaultHTTPAuthConfig()
+	cfg.url = srv.URL
+	cfg.timeout = 50 * time.Millisecond
+	b := newHTTPAuthBackend(cfg)
+	defer b.Close()
+	start := time.Now()
+	if _, err := b.Authenticate(pluginutil.ClientInfo{Username: "alice"}, "pwd", start); err == nil {
+		t.Fatalf("slow server should time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("timeout not enforced: %v", elapsed)
+	}
+}
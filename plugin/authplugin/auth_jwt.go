@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+const (
+	defaultJWTIdentityClaim = "sub"
+
+	jwtMatchUsername = "username"
+	jwtMatchClientID = "clientid"
+)
+
+// jwtConfig 为 JWT 认证参数，来自 jwt_* 配置项；密钥文件在 init 末尾统一加载。
+type jwtConfig struct {
+	enabled        bool
+	secrets        []string
+	publicKeyFiles []string
+	jwksFiles      []string
+	audience       string
+	issuer         string
+	// identityClaim 必须等于 identityMatch 指定的连接字段（username/clientid）。
+	identityClaim string
+	identityMatch string
+	leeway        time.Duration
+	// aclClaim 为空表示不从令牌读取 ACL（见 auth_jwt_acl.go）。
+	aclClaim string
+}
+
+func defaultJWTConfig() jwtConfig {
+	return jwtConfig{identityClaim: defaultJWTIdentityClaim, identityMatch: jwtMatchUsername}
+}
+
+// parseJWTMatch 解析 jwt_identity_match。
+func parseJWTMatch(v string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case jwtMatchUsername:
+		return jwtMatchUsername, true
+	case jwtMatchClientID, "client_id":
+		return jwtMatchClientID, true
+	default:
+		return "", false
+	}
+}
+
+// loadJWTKeys 按配置构建验签密钥集合；未配置任何密钥时报错，避免 JWT 模式形同虚设。
+func loadJWTKeys(cfg jwtConfig) (*pluginutil.JWTKeySet, error) {
+	keys := &pluginutil.JWTKeySet{}
+	for _, s := range cfg.secrets {
+		keys.AddHMACSecret([]byte(s))
+	}
+	for _, path := range cfg.publicKeyFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := keys.AddPEM(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, path := range cfg.jwksFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := keys.AddJWKS(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if keys.Len() == 0 {
+		return nil, errors.New("no jwt keys configured")
+	}
+	return keys, nil
+}
+
+// jwtReason 将校验错误映射为 client_auth_events.reason。
+func jwtReason(err error) string {
+	switch {
+	case errors.Is(err, pluginutil.ErrJWTUnsupportedAlg):
+		return authReasonJWTUnsupportedAlg
+	case errors.Is(err, pluginutil.ErrJWTUnknownKey):
+		return authReasonJWTUnknownKey
+	case errors.Is(err, pluginutil.ErrJWTSignature):
+		return authReasonJWTInvalidSignature
+	case errors.Is(err, pluginutil.ErrJWTExpired):
+		return authReasonJWTExpired
+	case errors.Is(err, pluginutil.ErrJWTMissingExp):
+		return authReasonJWTMissingExp
+	case errors.Is(err, pluginutil.ErrJWTNotYetValid):
+		return authReasonJWTNotYetValid
+	case errors.Is(err, pluginutil.ErrJWTAudience):
+		return authReasonJWTAudienceMismatch
+	case errors.Is(err, pluginutil.ErrJWTIssuer):
+		return authReasonJWTIssuerMismatch
+	default:
+		return authReasonJWTMalformed
+	}
+}
+
+// verifyJWTAuth 校验令牌并核对身份声明，返回声明与拒绝原因；原因为空表示放行。
+func verifyJWTAuth(cfg jwtConfig, keys *pluginutil.JWTKeySet, info pluginutil.ClientInfo, token string, now time.Time) (pluginutil.JWTClaims, string) {
+	claims, err := pluginutil.VerifyJWT(token, keys, pluginutil.JWTValidation{
+		Audience: cfg.audience,
+		Issuer:   cfg.issuer,
+		Leeway:   cfg.leeway,
+		Now:      now,
+	})
+	if err != nil {
+		return nil, jwtReason(err)
+	}
+	want := info.Username
+	if cfg.identityMatch == jwtMatchClientID {
+		want = info.ClientID
+	}
+	if got, ok := claims.String(cfg.identityClaim); !ok || got == "" || got != want {
+		return nil, authReasonJWTIdentityMismatch
+	}
+	return claims, ""
+}
+
+// parseJWTACLClaim 读取令牌中的 ACL 声明；令牌不含该声明时返回 nil。
+func parseJWTACLClaim(claims pluginutil.JWTClaims, name string) ([]aclRule, error) {
+	return parseACLGrant(claims[name])
+}
+
+// jwtAuthenticator 本地验签形如 JWT 的密码字段；普通口令交给下一个后端。
+// jwt_* 原因不计入失败锁定：签名无法暴力猜测，且令牌过期属于正常现象。
+type jwtAuthenticator struct {
+	cfg  jwtConfig
+	keys *pluginutil.JWTKeySet
+}
+
+func (jwtAuthenticator) Name() string { return authBackendJWT }
+
+func (a jwtAuthenticator) Authenticate(req *authRequest) authOutcome {
+	if !pluginutil.LooksLikeJWT(req.password) {
+		return authOutcome{decision: authNext}
+	}
+	claims, reason := verifyJWTAuth(a.cfg, a.keys, req.info, req.password, req.now)
+	var rules []aclRule
+	if reason == "" && a.cfg.aclClaim != "" {
+		var err error
+		if rules, err = parseJWTACLClaim(claims, a.cfg.aclClaim); err != nil {
+			reason = authReasonJWTACLInvalid
+		}
+	}
+	if reason != "" {
+		return authOutcome{decision: authDeny, reason: reason}
+	}
+	return authOutcome{decision: authAllow, reason: authReasonJWTOK, attrs: accountAttrs{acl: connACL{rules: rules}}}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func hs256Token(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + enc(claims)
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func TestVerifyJWTAuthIdentity(t *testing.T) {
+	cfg := defaultJWTConfig()
+	cfg.secrets = []string{"s3cret"}
+	keys, err := loadJWTKeys(cfg)
+	if err != nil {
+		t.Fatalf("loadJWTKeys: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	info := pluginutil.ClientInfo{Username: "alice", ClientID: "dev-1"}
+	exp := now.Add(time.Minute).Unix()
+
+	if _, reason := verifyJWTAuth(cfg, keys, info, hs256Token(t, "s3cret", map[string]any{"sub": "alice", "exp": exp}), now); reason != "" {
+		t.Fatalf("valid token reason = %q", reason)
+	}
+	if _, reason := verifyJWTAuth(cfg, keys, info, hs256Token(t, "s3cret", map[string]any{"sub": "bob", "exp": exp}), now); reason != authReasonJWTIdentityMismatch {
+		t.Fatalf("other subject reason = %q", reason)
+	}
+	if _, reason := verifyJWTAuth(cfg, keys, info, hs256Token(t, "s3cret", map[string]any{"exp": exp}), now); reason != authReasonJWTIdentityMismatch {
+		t.Fatalf("missing subject reason = %q", reason)
+	}
+
+	cfg.identityClaim = "cid"
+	cfg.identityMatch = jwtMatchClientID
+	if _, reason := verifyJWTAuth(cfg, keys, info, hs256Token(t, "s3cret", map[string]any{"cid": "dev-1", "exp": exp}), now); reason != "" {
+		t.Fatalf("clientid match reason = %q", reason)
+	}
+}
+
+func TestVerifyJWTAuthReasons(t *testing.T) {
+	cfg := defaultJWTConfig()
+	cfg.secrets = []string{"s3cret"}
+	keys, _ := loadJWTKeys(cfg)
+	now := time.Unix(1_700_000_000, 0)
+	info := pluginutil.ClientInfo{Username: "alice"}
+
+	cases := map[string]string{
+		hs256Token(t, "wrong", map[string]any{"sub": "alice"}):                                                   authReasonJWTInvalidSignature,
+		hs256Token(t, "s3cret", map[string]any{"sub": "alice", "exp": now.Unix() - 1}):                           authReasonJWTExpired,
+		hs256Token(t, "s3cret", map[string]any{"sub": "alice", "exp": now.Unix() + 120, "nbf": now.Unix() + 60}): authReasonJWTNotYetValid,
+		hs256Token(t, "s3cret", map[string]any{"sub": "alice"}):                                                  authReasonJWTMissingExp,
+		"eyJub3QganNvbg.e30.c2ln":                        authReasonJWTMalformed,
+		"eyJhbGciOiJub25lIn0.eyJzdWIiOiJhbGljZSJ9.":      authReasonJWTUnsupportedAlg,
+		"eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJhbGljZSJ9.c2ln": authReasonJWTUnknownKey,
+	}
+	for tok, want := range cases {
+		if _, reason := verifyJWTAuth(cfg, keys, info, tok, now); reason != want {
+			t.Errorf("token %q reason = %q, want %q", tok, reason, want)
+		}
+	}
+
+	cfg.audience, cfg.issuer = "mqtt", "idp"
+	if _, reason := verifyJWTAuth(cfg, keys, info, hs256Token(t, "s3cret", map[string]any{"sub": "alice", "iss": "idp", "exp": now.Unix() + 60}), now); reason != authReasonJWTAudienceMismatch {
+		t.Fatalf("audience reason = %q", reason)
+	}
+	if _, reason := verifyJWTAuth(cfg, keys, info, hs256Token(t, "s3cret", map[string]any{"sub": "alice", "aud": "mqtt", "exp": now.Unix() + 60}), now); reason != authReasonJWTIssuerMismatch {
+		t.Fatalf("issuer reason = %q", reason)
+	}
+}
+
+func TestLoadJWTKeys(t *testing.T) {
+	if _, err := loadJWTKeys(defaultJWTConfig()); err == nil {
+		t.Fatalf("loadJWTKeys without keys should fail")
+	}
+	cfg := defaultJWTConfig()
+	cfg.publicKeyFiles = []string{filepath.Join(t.TempDir(), "missing.pem")}
+	if _, err := loadJWTKeys(cfg); err == nil {
+		t.Fatalf("loadJWTKeys with missing file should fail")
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, []byte(`{"keys":[{"kty":"oct","kid":"a","k":"czNjcmV0"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg = defaultJWTConfig()
+	cfg.jwksFiles = []string{path}
+	keys, err := loadJWTKeys(cfg)
+	if err != nil || keys.Len() != 1 {
+		t.Fatalf("loadJWTKeys(jwks) = %v, %v", keys, err)
+	}
+}
+
+func TestParseJWTMatch(t *testing.T) {
+	for in, want := range map[string]string{"username": jwtMatchUsername, "ClientID": jwtMatchClientID, "client_id": jwtMatchClientID} {
+		if got, ok := parseJWTMatch(in); !ok || got != want {
+			t.Errorf("parseJWTMatch(%q) = %q, %v", in, got, ok)
+		}
+	}
+	if _, ok := parseJWTMatch("sub"); ok {
+		t.Errorf("parseJWTMatch(sub) should fail")
+	}
+}
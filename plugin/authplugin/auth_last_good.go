@@ -0,0 +1,390 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+const (
+	defaultLastGoodMaxAge       = 24 * time.Hour
+	defaultLastGoodSaveInterval = 60 * time.Second
+	lastGoodFileVersion         = 1
+)
+
+// lastGoodConfig 为 last_good_* 配置；size=0 表示不启用。
+type lastGoodConfig struct {
+	size         int
+	maxAge       time.Duration
+	path         string
+	saveInterval time.Duration
+}
+
+type lastGoodKey struct {
+	username string
+	clientID string
+}
+
+// lastGoodEntry 保存最近一次数据库认证成功时账户表中的哈希与属性，不保存明文密码。
+type lastGoodEntry struct {
+	key          lastGoodKey
+	passwordHash string
+	salt         string
+	attrs        accountAttrs
+	verifiedAt   time.Time
+}
+
+// lastGoodStore 为最近认证成功的凭据快照，数据库出错时用于放行已验证过的设备。
+// 按最近验证时间 LRU 淘汰，超过 maxAge 未重新验证的条目失效；可选持久化到本地文件，重启后仍可用。
+type lastGoodStore struct {
+	cfg lastGoodConfig
+
+	mu      sync.Mutex
+	entries map[lastGoodKey]*list.Element
+	lru     *list.List
+	dirty   bool
+
+	// saveMu 串行化写文件，避免后台保存与 Stop 时的保存交错。
+	saveMu sync.Mutex
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func newLastGoodStore(cfg lastGoodConfig) *lastGoodStore {
+	return &lastGoodStore{cfg: cfg, entries: map[lastGoodKey]*list.Element{}, lru: list.New()}
+}
+
+// Observe 根据数据库认证结果更新快照：成功时记录，账户不存在、被禁用或 clientid 不再匹配时删除，
+// 密码错误且账户哈希已变化（改过密码）时删除，避免旧密码在故障期间继续有效。
+func (s *lastGoodStore) Observe(info pluginutil.ClientInfo, allow bool, reason string, acct authAccount, now time.Time) {
+	key := lastGoodKey{username: info.Username, clientID: info.ClientID}
+	if allow {
+		s.put(&lastGoodEntry{key: key, passwordHash: acct.passwordHash, salt: acct.salt, attrs: lastGoodAttrs(acct.accountAttrs), verifiedAt: now})
+		return
+	}
+	switch reason {
+	case authReasonUserNotFound, authReasonUserDisabled:
+		s.InvalidateUser(info.Username)
+	case authReasonClientIDMismatch:
+		s.forget(key, "")
+	case authReasonInvalidPassword, authReasonUnsupportedHash:
+		s.forget(key, acct.passwordHash)
+	}
+}
+
+// Lookup 校验密码是否与快照一致；条目不存在、已过期或密码不符时返回 false。
+func (s *lastGoodStore) Lookup(info pluginutil.ClientInfo, password string, now time.Time) (accountAttrs, bool) {
+	if info.Username == "" || password == "" {
+		return accountAttrs{}, false
+	}
+	key := lastGoodKey{username: info.Username, clientID: info.ClientID}
+	s.mu.Lock()
+	el, found := s.entries[key]
+	if !found {
+		s.mu.Unlock()
+		return accountAttrs{}, false
+	}
+	e := *el.Value.(*lastGoodEntry)
+	if s.expired(&e, now) {
+		s.removeLocked(el)
+		s.mu.Unlock()
+		return accountAttrs{}, false
+	}
+	s.mu.Unlock()
+	// 哈希校验可能较慢（bcrypt/argon2id），不持锁进行。
+	ok, err := pluginutil.VerifyPassword(password, e.passwordHash, e.salt)
+	if err != nil || !ok {
+		return accountAttrs{}, false
+	}
+	return e.attrs, true
+}
+
+// InvalidateUser 删除指定用户名的全部条目。
+func (s *lastGoodStore) InvalidateUser(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for el := s.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*lastGoodEntry).key.username == username {
+			s.removeLocked(el)
+		}
+		el = next
+	}
+}
+
+// Len 返回当前条目数。
+func (s *lastGoodStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+func (s *lastGoodStore) put(e *lastGoodEntry) {
+	if s.cfg.size <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty = true
+	if el, found := s.entries[e.key]; found {
+		el.Value = e
+		s.lru.MoveToFront(el)
+		return
+	}
+	for s.lru.Len() >= s.cfg.size {
+		s.removeLocked(s.lru.Back())
+	}
+	s.entries[e.key] = s.lru.PushFront(e)
+}
+
+// forget 删除条目；currentHash 非空时仅在快照中的哈希与之不同时删除。
+func (s *lastGoodStore) forget(key lastGoodKey, currentHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, found := s.entries[key]
+	if !found {
+		return
+	}
+	if currentHash != "" && el.Value.(*lastGoodEntry).passwordHash == currentHash {
+		return
+	}
+	s.removeLocked(el)
+}
+
+func (s *lastGoodStore) expired(e *lastGoodEntry, now time.Time) bool {
+	return s.cfg.maxAge > 0 && now.Sub(e.verifiedAt) >= s.cfg.maxAge
+}
+
+func (s *lastGoodStore) removeLocked(el *list.Element) {
+	delete(s.entries, el.Value.(*lastGoodEntry).key)
+	s.lru.Remove(el)
+	s.dirty = true
+}
+
+// lastGoodAttrs 只保留故障期间仍需检查的属性（含超级用户标记、连接数上限与协议/监听器限制）；连接级 ACL 规则来自其它后端，不随快照保存。
+func lastGoodAttrs(attrs accountAttrs) accountAttrs {
+	return accountAttrs{validFrom: attrs.validFrom, validUntil: attrs.validUntil, allowedCIDRs: attrs.allowedCIDRs,
+		acl: connACL{superuser: attrs.acl.superuser}, maxConnections: attrs.maxConnections,
+		allowedProtocols: attrs.allowedProtocols, allowedListeners: attrs.allowedListeners}
+}
+
+// lastGoodFileEntry 为快照文件中的一条记录。allowed_cidrs / allowed_protocols / allowed_listeners 为 null 表示不限制，[] 表示一律拒绝。
+type lastGoodFileEntry struct {
+	Username       string    `json:"username"`
+	ClientID       string    `json:"clientid"`
+	PasswordHash   string    `json:"password_hash"`
+	Salt           string    `json:"salt,omitempty"`
+	VerifiedAt     time.Time `json:"verified_at"`
+	ValidFrom      time.Time `json:"valid_from"`
+	ValidUntil     time.Time `json:"valid_until"`
+	AllowedCIDRs   []string  `json:"allowed_cidrs"`
+	Superuser      bool      `json:"superuser,omitempty"`
+	MaxConnections int       `json:"max_connections,omitempty"`
+	// 旧版本文件没有以下字段，读取为 null，即不限制。
+	AllowedProtocols []string `json:"allowed_protocols"`
+	AllowedListeners []string `json:"allowed_listeners"`
+}
+
+type lastGoodFile struct {
+	Version int                 `json:"version"`
+	Entries []lastGoodFileEntry `json:"entries"`
+}
+
+// Load 读取快照文件，跳过已过期的条目；文件不存在时返回 0。
+func (s *lastGoodStore) Load(now time.Time) (int, error) {
+	data, err := os.ReadFile(s.cfg.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var f lastGoodFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return 0, fmt.Errorf("%s: %w", s.cfg.path, err)
+	}
+	if f.Version != lastGoodFileVersion {
+		return 0, fmt.Errorf("%s: unsupported version %d", s.cfg.path, f.Version)
+	}
+	// 按验证时间从旧到新写入，容量不足时淘汰最旧的条目。
+	sort.SliceStable(f.Entries, func(i, j int) bool { return f.Entries[i].VerifiedAt.Before(f.Entries[j].VerifiedAt) })
+	n := 0
+	for _, fe := range f.Entries {
+		e := &lastGoodEntry{
+			key:          lastGoodKey{username: fe.Username, clientID: fe.ClientID},
+			passwordHash: fe.PasswordHash,
+			salt:         fe.Salt,
+			verifiedAt:   fe.VerifiedAt,
+			attrs: accountAttrs{validFrom: fe.ValidFrom, validUntil: fe.ValidUntil, acl: connACL{superuser: fe.Superuser}, maxConnections: fe.MaxConnections,
+				allowedProtocols: fe.AllowedProtocols, allowedListeners: fe.AllowedListeners},
+		}
+		if fe.Username == "" || fe.PasswordHash == "" || s.expired(e, now) {
+			continue
+		}
+		if fe.AllowedCIDRs != nil {
+			e.attrs.allowedCIDRs = []netip.Prefix{}
+			for _, c := range fe.AllowedCIDRs {
+				p, err := netip.ParsePrefix(c)
+				if err != nil {
+					return n, fmt.Errorf("%s: invalid allowed_cidrs for %q: %w", s.cfg.path, fe.Username, err)
+				}
+				e.attrs.allowedCIDRs = append(e.attrs.allowedCIDRs, p)
+			}
+		}
+		s.put(e)
+		n++
+	}
+	s.mu.Lock()
+	s.dirty = false
+	s.mu.Unlock()
+	return n, nil
+}
+
+// Save 在有变化时把未过期的条目写入文件；先写临时文件再改名，避免中途退出留下半个文件。
+func (s *lastGoodStore) Save(now time.Time) error {
+	if s.cfg.path == "" {
+		return nil
+	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	f := lastGoodFile{Version: lastGoodFileVersion, Entries: make([]lastGoodFileEntry, 0, s.lru.Len())}
+	for el := s.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*lastGoodEntry)
+		if s.expired(e, now) {
+			continue
+		}
+		fe := lastGoodFileEntry{
+			Username:         e.key.username,
+			ClientID:         e.key.clientID,
+			PasswordHash:     e.passwordHash,
+			Salt:             e.salt,
+			VerifiedAt:       e.verifiedAt.UTC(),
+			ValidFrom:        e.attrs.validFrom,
+			ValidUntil:       e.attrs.validUntil,
+			Superuser:        e.attrs.acl.superuser,
+			MaxConnections:   e.attrs.maxConnections,
+			AllowedProtocols: e.attrs.allowedProtocols,
+			AllowedListeners: e.attrs.allowedListeners,
+		}
+		if e.attrs.allowedCIDRs != nil {
+			fe.AllowedCIDRs = make([]string, 0, len(e.attrs.allowedCIDRs))
+			for _, p := range e.attrs.allowedCIDRs {
+				fe.AllowedCIDRs = append(fe.AllowedCIDRs, p.String())
+			}
+		}
+		f.Entries = append(f.Entries, fe)
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	err := writeLastGoodFile(s.cfg.path, f)
+	if err != nil {
+		// 写入失败时保留脏标记，下次再试。
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func writeLastGoodFile(path string, f lastGoodFile) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// 文件中含密码哈希，仅允许 broker 进程用户读取。
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Start 启动后台协程按 saveInterval 保存快照；未配置文件时不启动。
+func (s *lastGoodStore) Start() {
+	if s.cfg.path == "" || s.cfg.saveInterval <= 0 {
+		return
+	}
+	s.stopCh, s.doneCh = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(s.doneCh)
+		ticker := time.NewTicker(s.cfg.saveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+			}
+			if err := s.Save(time.Now()); err != nil {
+				log(mosqLogWarning, "auth-plugin: save last good credentials failed", map[string]any{"last_good_file": s.cfg.path, "error": err.Error()})
+			}
+		}
+	}()
+}
+
+// Stop 停止后台保存并写入最后一次快照。
+func (s *lastGoodStore) Stop() {
+	if s.stopCh != nil {
+		close(s.stopCh)
+		<-s.doneCh
+		s.stopCh, s.doneCh = nil, nil
+	}
+	if err := s.Save(time.Now()); err != nil {
+		log(mosqLogWarning, "auth-plugin: save last good credentials failed", map[string]any{"last_good_file": s.cfg.path, "error": err.Error()})
+	}
+}
+
+// lastGoodFallback 在数据库出错时查询快照；密码与最近一次成功认证一致时放行，其余情况仍按 fail_open 处理。
+func lastGoodFallback(req *authRequest, dbErr error) (authOutcome, bool) {
+	s := lastGood
+	if s == nil {
+		return authOutcome{}, false
+	}
+	attrs, ok := s.Lookup(req.info, req.password, req.now)
+	if !ok {
+		return authOutcome{}, false
+	}
+	log(mosqLogWarning, "auth-plugin: db error, allowed by last good credential", map[string]any{"username": req.info.Username, "client_id": req.info.ClientID, "error": dbErr.Error()})
+	return authOutcome{decision: authAllow, reason: authReasonDBErrorCachedAllow, attrs: attrs}, true
+}
+
+// stopLastGood 保存快照并停用；插件重载与退出时调用。
+func stopLastGood() {
+	if lastGood == nil {
+		return
+	}
+	lastGood.Stop()
+	lastGood = nil
+}
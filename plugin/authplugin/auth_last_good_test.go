@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func lastGoodAccount(t *testing.T, password string) authAccount {
+	t.Helper()
+	hash, err := pluginutil.HashPassword(pluginutil.HashAlgoSHA256, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authAccount{passwordHash: hash, enabled: true}
+}
+
+func TestLastGoodObserveAndLookup(t *testing.T) {
+	s := newLastGoodStore(lastGoodConfig{size: 8, maxAge: time.Hour})
+	now := time.Unix(1700000000, 0)
+	info := pluginutil.ClientInfo{Username: "dev1", ClientID: "c1"}
+	acct := lastGoodAccount(t, "pwd")
+
+	if _, ok := s.Lookup(info, "pwd", now); ok {
+		t.Fatal("empty store should miss")
+	}
+	s.Observe(info, true, authReasonOK, acct, now)
+	if _, ok := s.Lookup(info, "pwd", now.Add(time.Minute)); !ok {
+		t.Fatal("verified credential should match")
+	}
+	if _, ok := s.Lookup(info, "wrong", now); ok {
+		t.Fatal("wrong password should miss")
+	}
+	if _, ok := s.Lookup(pluginutil.ClientInfo{Username: "dev1", ClientID: "c2"}, "pwd", now); ok {
+		t.Fatal("different client id should miss")
+	}
+	if _, ok := s.Lookup(info, "pwd", now.Add(time.Hour)); ok {
+		t.Fatal("entry older than max age should miss")
+	}
+	if s.Len() != 0 {
+		t.Fatalf("expired entry should be removed, len = %d", s.Len())
+	}
+}
+
+func TestLastGoodObserveForgets(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	info := pluginutil.ClientInfo{Username: "dev1", ClientID: "c1"}
+	acct := lastGoodAccount(t, "pwd")
+	changed := lastGoodAccount(t, "new")
+
+	cases := []struct {
+		name   string
+		reason string
+		acct   authAccount
+		keep   bool
+	}{
+		{"wrong password, same hash", authReasonInvalidPassword, acct, true},
+		{"password changed", authReasonInvalidPassword, changed, false},
+		{"user removed", authReasonUserNotFound, authAccount{}, false},
+		{"user disabled", authReasonUserDisabled, acct, false},
+		{"clientid rebound", authReasonClientIDMismatch, acct, false},
+	}
+	for _, tc := range cases {
+		s := newLastGoodStore(lastGoodConfig{size: 8, maxAge: time.Hour})
+		s.Observe(info, true, authReasonOK, acct, now)
+		s.Observe(info, false, tc.reason, tc.acct, now)
+		if _, ok := s.Lookup(info, "pwd", now); ok != tc.keep {
+			t.Errorf("%s: lookup = %v, want %v", tc.name, ok, tc.keep)
+		}
+	}
+}
+
+func TestLastGoodEvictsOldest(t *testing.T) {
+	s := newLastGoodStore(lastGoodConfig{size: 2})
+	now := time.Unix(1700000000, 0)
+	acct := lastGoodAccount(t, "pwd")
+	for _, u := range []string{"a", "b", "c"} {
+		s.Observe(pluginutil.ClientInfo{Username: u}, true, authReasonOK, acct, now)
+	}
+	if _, ok := s.Lookup(pluginutil.ClientInfo{Username: "a"}, "pwd", now); ok {
+		t.Fatal("oldest entry should be evicted")
+	}
+	if _, ok := s.Lookup(pluginutil.ClientInfo{Username: "c"}, "pwd", now); !ok {
+		t.Fatal("newest entry should be kept")
+	}
+}
+
+func TestLastGoodSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last_good.json")
+	cfg := lastGoodConfig{size: 8, maxAge: time.Hour, path: path}
+	now := time.Unix(1700000000, 0)
+	open := lastGoodAccount(t, "pwd")
+	locked := lastGoodAccount(t, "pwd")
+	locked.allowedCIDRs = []netip.Prefix{}
+	ranged := lastGoodAccount(t, "pwd")
+	ranged.allowedCIDRs = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	ranged.validUntil = now.Add(24 * time.Hour).UTC()
+	ranged.allowedProtocols = []string{"MQTT/5.0"}
+	ranged.allowedListeners = []string{}
+
+	s := newLastGoodStore(cfg)
+	s.Observe(pluginutil.ClientInfo{Username: "open"}, true, authReasonOK, open, now)
+	s.Observe(pluginutil.ClientInfo{Username: "locked"}, true, authReasonOK, locked, now)
+	s.Observe(pluginutil.ClientInfo{Username: "ranged", ClientID: "c1"}, true, authReasonOK, ranged, now)
+	s.Observe(pluginutil.ClientInfo{Username: "stale"}, true, authReasonOK, open, now.Add(-2*time.Hour))
+	if err := s.Save(now); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("snapshot file mode = %v, %v; want 0600", fi.Mode().Perm(), err)
+	}
+
+	loaded := newLastGoodStore(cfg)
+	n, err := loaded.Load(now)
+	if err != nil || n != 3 {
+		t.Fatalf("Load() = %d, %v; want 3, nil", n, err)
+	}
+	if attrs, ok := loaded.Lookup(pluginutil.ClientInfo{Username: "open"}, "pwd", now); !ok || attrs.allowedCIDRs != nil {
+		t.Fatalf("open entry = %+v, %v", attrs, ok)
+	}
+	if attrs, ok := loaded.Lookup(pluginutil.ClientInfo{Username: "locked"}, "pwd", now); !ok || attrs.allowedCIDRs == nil || len(attrs.allowedCIDRs) != 0 {
+		t.Fatalf("empty allowed_cidrs should stay non-nil: %+v, %v", attrs, ok)
+	}
+	attrs, ok := loaded.Lookup(pluginutil.ClientInfo{Username: "ranged", ClientID: "c1"}, "pwd", now)
+	if !ok || len(attrs.allowedCIDRs) != 1 || !attrs.validUntil.Equal(ranged.validUntil) ||
+		!reflect.DeepEqual(attrs.allowedProtocols, ranged.allowedProtocols) || attrs.allowedListeners == nil || len(attrs.allowedListeners) != 0 {
+		t.Fatalf("ranged entry = %+v, %v", attrs, ok)
+	}
+	if _, ok := loaded.Lookup(pluginutil.ClientInfo{Username: "stale"}, "pwd", now); ok {
+		t.Fatal("expired entry should not be saved")
+	}
+}
+
+func TestLastGoodLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if n, err := newLastGoodStore(lastGoodConfig{size: 8, path: filepath.Join(dir, "missing.json")}).Load(time.Now()); n != 0 || err != nil {
+		t.Fatalf("missing file: Load() = %d, %v", n, err)
+	}
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newLastGoodStore(lastGoodConfig{size: 8, path: bad}).Load(time.Now()); err == nil {
+		t.Fatal("corrupt file should fail to load")
+	}
+}
+
+func TestPostgresAuthenticatorLastGoodFallback(t *testing.T) {
+	// poolHolder 未配置，数据库访问必然出错。
+	old := lastGood
+	defer func() { lastGood = old }()
+	now := time.Now()
+	info := pluginutil.ClientInfo{Username: "dev1", ClientID: "c1"}
+	lastGood = newLastGoodStore(lastGoodConfig{size: 8, maxAge: time.Hour})
+	lastGood.Observe(info, true, authReasonOK, lastGoodAccount(t, "pwd"), now)
+
+	out := postgresAuthenticator{}.Authenticate(&authRequest{info: info, password: "pwd", now: now})
+	if out.err != nil || out.decision != authAllow || out.reason != authReasonDBErrorCachedAllow {
+		t.Fatalf("known credential outcome = %+v", out)
+	}
+	out = postgresAuthenticator{}.Authenticate(&authRequest{info: info, password: "other", now: now})
+	if out.err == nil || out.reason != authReasonDBError || out.failOpenReason != authReasonDBErrorFailOpen {
+		t.Fatalf("unknown credential outcome = %+v", out)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+const (
+	defaultLockoutWindow   = 5 * time.Minute
+	defaultLockoutDuration = time.Minute
+	defaultLockoutMax      = time.Hour
+	// lockoutMaxEntries 限制内存中跟踪的 key 数量，超过后先清理已过期状态。
+	lockoutMaxEntries = 65536
+
+	lockoutKeyUserPrefix = "user:"
+	lockoutKeyPeerPrefix = "peer:"
+)
+
+// lockoutPolicy 描述失败计数窗口与锁定时长；threshold<=0 表示关闭。
+type lockoutPolicy struct {
+	threshold int
+	window    time.Duration
+	duration  time.Duration
+	max       time.Duration
+}
+
+// lockoutState 保存单个 key（用户名或来源 IP）的失败计数与锁定状态。
+type lockoutState struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+	// lockouts 为连续锁定次数，锁定时长按 2^(lockouts-1) 指数增长。
+	lockouts int
+}
+
+// lockoutTracker 在内存中跟踪失败次数，线程安全。
+type lockoutTracker struct {
+	mu      sync.Mutex
+	policy  lockoutPolicy
+	entries map[string]*lockoutState
+}
+
+func newLockoutTracker(policy lockoutPolicy) *lockoutTracker {
+	return &lockoutTracker{policy: policy, entries: map[string]*lockoutState{}}
+}
+
+// LockedUntil 返回 key 当前是否处于锁定期。
+func (t *lockoutTracker) LockedUntil(key string, now time.Time) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.entries[key]
+	if !ok || !now.Before(st.lockedUntil) {
+		return time.Time{}, false
+	}
+	return st.lockedUntil, true
+}
+
+// RecordFailure 累计一次失败；达到阈值时进入锁定并返回 locked=true。
+func (t *lockoutTracker) RecordFailure(key string, now time.Time) (until time.Time, lockouts int, locked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.entries[key]
+	if !ok {
+		if len(t.entries) >= lockoutMaxEntries {
+			t.pruneLocked(now)
+			if len(t.entries) >= lockoutMaxEntries {
+				return time.Time{}, 0, false
+			}
+		}
+		st = &lockoutState{}
+		t.entries[key] = st
+	}
+	// 上次锁定结束后已平稳超过最大锁定时长，退避等级归零。
+	if st.lockouts > 0 && now.Sub(st.lockedUntil) > t.policy.max {
+		st.lockouts = 0
+	}
+	if st.failures == 0 || now.Sub(st.windowStart) > t.policy.window {
+		st.failures = 0
+		st.windowStart = now
+	}
+	st.failures++
+	if st.failures < t.policy.threshold {
+		return time.Time{}, st.lockouts, false
+	}
+
+	st.lockouts++
+	st.failures = 0
+	st.lockedUntil = now.Add(lockoutDuration(t.policy, st.lockouts))
+	return st.lockedUntil, st.lockouts, true
+}
+
+// Reset 清除 key 的失败与锁定状态，返回此前是否存在锁定记录。
+func (t *lockoutTracker) Reset(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.entries[key]
+	if !ok {
+		return false
+	}
+	delete(t.entries, key)
+	return st.lockouts > 0
+}
+
+// Restore 从持久化记录恢复锁定状态。
+func (t *lockoutTracker) Restore(key string, until time.Time, lockouts int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[key] = &lockoutState{lockedUntil: until, lockouts: lockouts}
+}
+
+func (t *lockoutTracker) pruneLocked(now time.Time) {
+	for k, st := range t.entries {
+		idle := now.Sub(st.windowStart) > t.policy.window && !now.Before(st.lockedUntil)
+		if idle && (st.lockouts == 0 || now.Sub(st.lockedUntil) > t.policy.max) {
+			delete(t.entries, k)
+		}
+	}
+}
+
+// lockoutDuration 计算第 n 次连续锁定的时长：duration * 2^(n-1)，不超过 max。
+func lockoutDuration(policy lockoutPolicy, n int) time.Duration {
+	d := policy.duration
+	for i := 1; i < n && d < policy.max; i++ {
+		d *= 2
+	}
+	if d > policy.max {
+		d = policy.max
+	}
+	return d
+}
+
+// lockoutKeys 返回需要检查的 key：用户名与来源地址。
+func lockoutKeys(info pluginutil.ClientInfo) []string {
+	keys := make([]string, 0, 2)
+	if info.Username != "" {
+		keys = append(keys, lockoutKeyUserPrefix+info.Username)
+	}
+	// 来源地址按规范化后的 IP 计数（去掉端口与 IPv4 映射前缀），无法解析时不按来源锁定。
+	if addr, ok := pluginutil.PeerAddr(info.Peer); ok {
+		keys = append(keys, lockoutKeyPeerPrefix+addr.String())
+	}
+	return keys
+}
+
+// checkLockout 判断用户名或来源地址是否处于锁定期。
+func checkLockout(info pluginutil.ClientInfo, now time.Time) bool {
+	t := authLockouts
+	if t == nil {
+		return false
+	}
+	for _, key := range lockoutKeys(info) {
+		if _, locked := t.LockedUntil(key, now); locked {
+			return true
+		}
+	}
+	return false
+}
+
+// observeAuthResult 根据认证结果更新失败计数：
+// 用户名只统计 invalid_password；来源地址还统计 user_not_found，防止枚举用户名。
+func observeAuthResult(info pluginutil.ClientInfo, allow bool, reason string, now time.Time) {
+	t := authLockouts
+	if t == nil {
+		return
+	}
+	if allow {
+		userKey := lockoutKeyUserPrefix + info.Username
+		if t.Reset(userKey) && lockoutPersist {
+			persistLockoutAsync(userKey, time.Time{}, 0)
+		}
+		return
+	}
+	var keys []string
+	switch reason {
+	case authReasonInvalidPassword:
+		keys = lockoutKeys(info)
+	case authReasonUserNotFound:
+		if info.Peer != "" {
+			keys = []string{lockoutKeyPeerPrefix + info.Peer}
+		}
+	default:
+		return
+	}
+	for _, key := range keys {
+		until, lockouts, locked := t.RecordFailure(key, now)
+		if !locked {
+			continue
+		}
+		log(mosqLogWarning, "auth-plugin: auth locked out", map[string]any{"key": key, "locked_until": until.UTC().Format(time.RFC3339), "lockouts": lockouts})
+		if lockoutPersist {
+			persistLockoutAsync(key, until, lockouts)
+		}
+	}
+}
+
+// persistLockoutAsync 异步写入/删除持久化锁定记录；until 为零值表示删除。
+func persistLockoutAsync(key string, until time.Time, lockouts int) {
+	lockoutWG.Add(1)
+	go func() {
+		defer lockoutWG.Done()
+		if err := persistLockout(key, until, lockouts); err != nil {
+			log(mosqLogWarning, "auth-plugin: persist lockout failed", map[string]any{"key": key, "error": err.Error()})
+		}
+	}()
+}
+
+func persistLockout(key string, until time.Time, lockouts int) error {
+	ctx := context.Background()
+	cancel := func() {}
+	// 保留 timeout<=0 时“无超时”的旧行为。
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	defer cancel()
+
+	p, err := poolHolder.Ensure(ctx, pluginutil.PGPrimary)
+	if err != nil {
+		return err
+	}
+	if until.IsZero() {
+		_, err = p.Exec(ctx, deleteLockoutSQL, key)
+	} else {
+		_, err = p.Exec(ctx, upsertLockoutSQL, key, until.UTC(), lockouts)
+	}
+	poolHolder.Report(p, err)
+	return err
+}
+
+// restoreLockouts 在初始化时加载仍未到期的锁定记录，使锁定跨 Broker 重启生效。
+func restoreLockouts(ctx context.Context, t *lockoutTracker) (int, error) {
+	p, err := poolHolder.Ensure(ctx, pluginutil.PGPrimary)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := p.Query(ctx, selectActiveLockoutsSQL)
+	if err != nil {
+		poolHolder.Report(p, err)
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var key string
+		var until time.Time
+		var lockouts int32
+		if err := rows.Scan(&key, &until, &lockouts); err != nil {
+			poolHolder.Report(p, err)
+			return n, err
+		}
+		t.Restore(key, until, int(lockouts))
+		n++
+	}
+	err = rows.Err()
+	poolHolder.Report(p, err)
+	return n, err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func testLockoutPolicy() lockoutPolicy {
+	return lockoutPolicy{threshold: 3, window: time.Minute, duration: 10 * time.Second, max: 40 * time.Second}
+}
+
+func TestLockoutTrackerLocksAfterThreshold(t *testing.T) {
+	tr := newLockoutTracker(testLockoutPolicy())
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 2; i++ {
+		if _, _, locked := tr.RecordFailure("user:alice", now); locked {
+			t.Fatalf("should not lock before threshold, attempt=%d", i+1)
+		}
+	}
+	until, lockouts, locked := tr.RecordFailure("user:alice", now)
+	if !locked || lockouts != 1 || !until.Equal(now.Add(10*time.Second)) {
+		t.Fatalf("third failure = (%v, %d, %v), want lock for 10s", until, lockouts, locked)
+	}
+	if _, locked := tr.LockedUntil("user:alice", now.Add(5*time.Second)); !locked {
+		t.Fatal("key should be locked within lockout duration")
+	}
+	if _, locked := tr.LockedUntil("user:alice", now.Add(10*time.Second)); locked {
+		t.Fatal("key should be unlocked after lockout duration")
+	}
+}
+
+func TestLockoutTrackerWindowResets(t *testing.T) {
+	tr := newLockoutTracker(testLockoutPolicy())
+	now := time.Unix(1700000000, 0)
+	tr.RecordFailure("user:alice", now)
+	tr.RecordFailure("user:alice", now)
+	// 窗口过期后重新计数。
+	if _, _, locked := tr.RecordFailure("user:alice", now.Add(2*time.Minute)); locked {
+		t.Fatal("failures outside the window should not accumulate")
+	}
+}
+
+func TestLockoutDurationBackoff(t *testing.T) {
+	p := testLockoutPolicy()
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 40 * time.Second}
+	for i, w := range want {
+		if got := lockoutDuration(p, i+1); got != w {
+			t.Fatalf("lockoutDuration(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestLockoutTrackerResetOnSuccess(t *testing.T) {
+	tr := newLockoutTracker(testLockoutPolicy())
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 3; i++ {
+		tr.RecordFailure("user:alice", now)
+	}
+	if !tr.Reset("user:alice") {
+		t.Fatal("Reset should report a previous lockout")
+	}
+	if _, locked := tr.LockedUntil("user:alice", now); locked {
+		t.Fatal("key should be unlocked after Reset")
+	}
+}
+
+func TestObserveAuthResultCountsPeerForUnknownUsers(t *testing.T) {
+	old := authLockouts
+	t.Cleanup(func() { authLockouts = old })
+	authLockouts = newLockoutTracker(testLockoutPolicy())
+
+	now := time.Unix(1700000000, 0)
+	for _, user := range []string{"a", "b", "c"} {
+		observeAuthResult(pluginutil.ClientInfo{Username: user, Peer: "10.0.0.1"}, false, authReasonUserNotFound, now)
+	}
+	if !checkLockout(pluginutil.ClientInfo{Username: "d", Peer: "10.0.0.1"}, now) {
+		t.Fatal("peer should be locked after repeated user_not_found")
+	}
+	if checkLockout(pluginutil.ClientInfo{Username: "d", Peer: "10.0.0.2"}, now) {
+		t.Fatal("other peers should not be locked")
+	}
+}
+
+func TestLockoutKeysNormalizePeer(t *testing.T) {
+	mapped := lockoutKeys(pluginutil.ClientInfo{Peer: "::ffff:1.2.3.4"})
+	plain := lockoutKeys(pluginutil.ClientInfo{Peer: "1.2.3.4"})
+	withPort := lockoutKeys(pluginutil.ClientInfo{Peer: "1.2.3.4:5678"})
+	if len(mapped) != 1 || len(plain) != 1 || len(withPort) != 1 || mapped[0] != plain[0] || withPort[0] != plain[0] {
+		t.Fatalf("peer keys = %v, %v, %v, want one shared key", mapped, plain, withPort)
+	}
+	if keys := lockoutKeys(pluginutil.ClientInfo{Username: "u", Peer: "not-an-ip"}); len(keys) != 1 || keys[0] != lockoutKeyUserPrefix+"u" {
+		t.Fatalf("unparsable peer keys = %v, want only the username key", keys)
+	}
+}
@@ -1,4 +1,6 @@
 #include <mosquitto.h>
+#include <openssl/crypto.h>
+#include <openssl/x509.h>
 
 /* 
  * Mosquitto <-> Go 桥接层
@@ -35,6 +37,11 @@ int mosquitto_plugin_cleanup(void *userdata, struct mosquitto_opt *options, int
 
 /* Go 暴露的事件回调 */
 int basic_auth_cb_c(int event, void *event_data, void *userdata);
+int acl_check_cb_c(int event, void *event_data, void *userdata);
+int tick_cb_c(int event, void *event_data, void *userdata);
+int disconnect_cb_c(int event, void *event_data, void *userdata);
+int ext_auth_start_cb_c(int event, void *event_data, void *userdata);
+int ext_auth_continue_cb_c(int event, void *event_data, void *userdata);
 
 typedef int (*mosq_event_cb)(int event, void *event_data, void *userdata);
 
@@ -53,3 +60,23 @@ void go_mosq_log(int level, const char* msg) {
     /* 保持日志格式化逻辑在 C 端处理，避免 Go 处理变参导致崩溃 */
     mosquitto_log_printf(level, "%s", msg);
 }
+
+/*
+ * 客户端证书以 DER 交给 Go 解析，避免 Go 直接操作 OpenSSL 对象。
+ * mosquitto_client_certificate 返回的 X509 需由调用方释放；*der 由 OpenSSL 分配，用 go_mosq_free_der 释放。
+ */
+int go_mosq_client_cert_der(const struct mosquitto *client, unsigned char **der) {
+    X509 *cert = mosquitto_client_certificate(client);
+    int len;
+    if (cert == NULL) {
+        return 0;
+    }
+    *der = NULL;
+    len = i2d_X509(cert, der);
+    X509_free(cert);
+    return len;
+}
+
+void go_mosq_free_der(unsigned char *der) {
+    OPENSSL_free(der);
+}
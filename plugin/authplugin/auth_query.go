@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// authQueryMaxParams 为账户查询可用的位置参数：$1=username $2=clientid $3=tenant。
+	authQueryMaxParams = 3
+	// builtinAccountParams 为内置账户查询使用的参数个数。
+	builtinAccountParams = 2
+	// authEventQueryMaxParams 为事件写入可用的位置参数，顺序见 authEventArgs。
+	authEventQueryMaxParams = 9
+)
+
+// authAccountRequiredColumns 为账户查询必须返回的列；其余已知列可选，未知列忽略。
+var authAccountRequiredColumns = []string{"password_hash"}
+
+// accountsTable 为内置 SQL 使用的账户表；schema 多租户时改用租户 schema 下的同名表。
+const accountsTable = "mqtt_accounts"
+
+// authAccountOptionalColumns 为内置账户查询的可选列，mqtt_accounts 中存在时才读取，含义见 loadAccount。
+var authAccountOptionalColumns = []string{
+	"clientid_match", "valid_from", "valid_until", "allowed_cidrs", "allowed_protocols", "allowed_listeners",
+	"max_connections", "is_superuser", "scram_verifier", "cert_fingerprint", "revoked_cert_fingerprints",
+}
+
+// authQuerySet 保存当前生效的账户查询与事件写入 SQL，以及校验得到的参数个数。
+type authQuerySet struct {
+	mu sync.RWMutex
+
+	account       string
+	event         string
+	accountParams int
+	// eventFields 为事件写入依次传入的参数在 authEventArgs 中的下标。
+	eventFields []int
+	// accountOptional 为内置账户查询读取的可选列，多租户查询按同一列清单生成。
+	accountOptional []string
+	// builtinAccount / builtinEvent 表示使用内置 SQL，校验时按表结构生成列清单。
+	builtinAccount bool
+	builtinEvent   bool
+	// validated=false 表示 SQL 尚未成功在数据库上 prepare，首次使用前会补做校验。
+	validated bool
+}
+
+// Reset 恢复为内置 SQL；内置 SQL 先只读写必需列，校验时按 mqtt_accounts / client_auth_events 的实际列补全可选列。
+func (q *authQuerySet) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.account = accountSQL(accountsTable, nil, false)
+	q.accountOptional = nil
+	q.accountParams = builtinAccountParams
+	q.event, q.eventFields = eventSQL(authEventFields[:authEventBaseFields])
+	q.builtinAccount = true
+	q.builtinEvent = true
+	q.validated = false
+}
+
+// SetAccount 设置自定义账户查询，等待校验。
+func (q *authQuerySet) SetAccount(sql string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.account = sql
+	q.builtinAccount = false
+	q.validated = false
+}
+
+// SetEvent 设置自定义事件写入 SQL，等待校验。
+func (q *authQuerySet) SetEvent(sql string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.event = sql
+	q.builtinEvent = false
+	q.validated = false
+}
+
+// Account 返回账户查询与应传入的参数个数。
+func (q *authQuerySet) Account() (string, int) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.account, q.accountParams
+}
+
+// Event 返回事件写入 SQL 与应传入的参数（authEventArgs 的下标）；copyColumns 非空表示内置 SQL，可按这些列 COPY。
+func (q *authQuerySet) Event() (sql string, fields []int, copyColumns []string) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.builtinEvent {
+		copyColumns = make([]string, len(q.eventFields))
+		for i, f := range q.eventFields {
+			copyColumns[i] = authEventFields[f]
+		}
+	}
+	return q.event, q.eventFields, copyColumns
+}
+
+// BuiltinAccount 报告账户查询是否为内置 SQL，并返回其读取的可选列。
+func (q *authQuerySet) BuiltinAccount() ([]string, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.accountOptional, q.builtinAccount
+}
+
+// Ensure 在首次使用前校验 SQL；已校验时直接返回。
+func (q *authQuerySet) Ensure(ctx context.Context, p *pgxpool.Pool) error {
+	q.mu.RLock()
+	validated := q.validated
+	q.mu.RUnlock()
+	if validated {
+		return nil
+	}
+	return q.Validate(ctx, p)
+}
+
+// Validate 在数据库上 prepare SQL，检查参数个数与必需列，并记录实际参数个数；
+// 内置账户查询先按 mqtt_accounts 的实际列生成。
+func (q *authQuerySet) Validate(ctx context.Context, p *pgxpool.Pool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.validated {
+		return nil
+	}
+
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	account, optional := q.account, q.accountOptional
+	if q.builtinAccount {
+		present, err := tableColumns(ctx, conn.Conn(), accountsTable)
+		if err != nil {
+			return fmt.Errorf("%s: %w", accountsTable, err)
+		}
+		if optional, err = builtinAccountColumns(present); err != nil {
+			return err
+		}
+		account = accountSQL(accountsTable, optional, false)
+		// column 多租户模式实际执行带 tenant_id 条件的查询，一并校验。
+		if tenantColumnMode() {
+			if _, err := conn.Conn().Prepare(ctx, "", accountSQL(accountsTable, optional, true)); err != nil {
+				return fmt.Errorf("tenant account query: %w", err)
+			}
+		}
+	}
+
+	// 使用匿名语句只做描述，不在服务端留下命名预处理语句。
+	accountDesc, err := conn.Conn().Prepare(ctx, "", account)
+	if err != nil {
+		return fmt.Errorf("auth_query: %w", err)
+	}
+	if n := len(accountDesc.ParamOIDs); n > authQueryMaxParams {
+		return fmt.Errorf("auth_query: uses %d parameters, at most %d ($1=username $2=clientid $3=tenant)", n, authQueryMaxParams)
+	}
+	columns := make(map[string]struct{}, len(accountDesc.Fields))
+	for _, f := range accountDesc.Fields {
+		columns[f.Name] = struct{}{}
+	}
+	var missing []string
+	for _, col := range authAccountRequiredColumns {
+		if _, ok := columns[col]; !ok {
+			missing = append(missing, col)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("auth_query: missing required columns: %s", strings.Join(missing, ","))
+	}
+
+	event, eventFields := q.event, q.eventFields
+	if q.builtinEvent {
+		present, err := tableColumns(ctx, conn.Conn(), "client_auth_events")
+		if err != nil {
+			return fmt.Errorf("client_auth_events: %w", err)
+		}
+		columns := append([]string(nil), authEventFields[:authEventBaseFields]...)
+		for _, col := range authEventFields[authEventBaseFields:] {
+			// tenant_id 只在启用多租户时写入。
+			if present[col] && (col != "tenant_id" || tenantCfg.separator != "") {
+				columns = append(columns, col)
+			}
+		}
+		event, eventFields = eventSQL(columns)
+	}
+	eventDesc, err := conn.Conn().Prepare(ctx, "", event)
+	if err != nil {
+		return fmt.Errorf("auth_event_query: %w", err)
+	}
+	if n := len(eventDesc.ParamOIDs); n > authEventQueryMaxParams {
+		return fmt.Errorf("auth_event_query: uses %d parameters, at most %d", n, authEventQueryMaxParams)
+	}
+	if !q.builtinEvent {
+		// 自定义 SQL 按位置使用前 N 个参数。
+		eventFields = make([]int, len(eventDesc.ParamOIDs))
+		for i := range eventFields {
+			eventFields[i] = i
+		}
+	}
+
+	q.account, q.accountOptional = account, optional
+	q.accountParams = len(accountDesc.ParamOIDs)
+	q.event, q.eventFields = event, eventFields
+	q.validated = true
+	return nil
+}
+
+// builtinAccountColumns 返回 mqtt_accounts 中存在的可选列；column 多租户模式要求表中有 tenant_id 列。
+func builtinAccountColumns(present map[string]bool) ([]string, error) {
+	if tenantColumnMode() && !present["tenant_id"] {
+		return nil, fmt.Errorf("%s: missing tenant_id column required by tenant_mode=%s", accountsTable, tenantModeColumn)
+	}
+	var optional []string
+	for _, col := range authAccountOptionalColumns {
+		if present[col] {
+			optional = append(optional, col)
+		}
+	}
+	return optional, nil
+}
+
+// accountSQL 生成内置账户查询：table 为账户表（已转义的限定名），optional 为表中存在的可选列；
+// tenantColumn=true 时按 tenant_id 列限定租户（$3）。
+func accountSQL(table string, optional []string, tenantColumn bool) string {
+	var extra strings.Builder
+	for _, col := range optional {
+		extra.WriteString(", ")
+		extra.WriteString(col)
+	}
+	cond := ""
+	if tenantColumn {
+		cond = " AND tenant_id IS NOT DISTINCT FROM $3"
+	}
+	return fmt.Sprintf(selectAuthAccountSQL, extra.String(), table, cond)
+}
+
+// eventSQL 生成写入指定列的内置事件 SQL，并返回各列在 authEventArgs 中的下标。
+func eventSQL(columns []string) (string, []int) {
+	fields := make([]int, 0, len(columns))
+	params := make([]string, 0, len(columns))
+	for _, col := range columns {
+		fields = append(fields, slices.Index(authEventFields, col))
+		params = append(params, fmt.Sprintf("$%d", len(params)+1))
+	}
+	return fmt.Sprintf(`
+INSERT INTO client_auth_events
+  (%s)
+VALUES (%s)
+`, strings.Join(columns, ", "), strings.Join(params, ", ")), fields
+}
+
+// tableColumns 返回表的列名集合；只描述 SELECT * 的结果列，不读取数据。
+func tableColumns(ctx context.Context, conn *pgx.Conn, table string) (map[string]bool, error) {
+	desc, err := conn.Prepare(ctx, "", "SELECT * FROM "+table+" LIMIT 0")
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool, len(desc.Fields))
+	for _, f := range desc.Fields {
+		columns[f.Name] = true
+	}
+	return columns, nil
+}
+
+// columnString 将可空文本列转为字符串；NULL 返回空串。
+func columnString(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	default:
+		return ""
+	}
+}
+
+// columnBool 兼容 boolean 与 smallint/integer 两种启用标记写法；NULL 或未知类型返回 def。
+func columnBool(v any, def bool) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case int16:
+		return x != 0
+	case int32:
+		return x != 0
+	case int64:
+		return x != 0
+	default:
+		return def
+	}
+}
+
+// columnInt 将可空整数列转为 int；NULL 或非整数类型返回 0。
+func columnInt(v any) int {
+	switch x := v.(type) {
+	case int16:
+		return int(x)
+	case int32:
+		return int(x)
+	case int64:
+		return int(x)
+	default:
+		return 0
+	}
+}
+
+// columnTime 将可空时间列转为 time.Time；NULL 或非时间类型返回零值。
+func columnTime(v any) time.Time {
+	if x, ok := v.(time.Time); ok {
+		return x
+	}
+	return time.Time{}
+}
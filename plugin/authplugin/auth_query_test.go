@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuthQuerySetReset(t *testing.T) {
+	var q authQuerySet
+	q.SetAccount("SELECT 1")
+	q.Reset()
+	sql, n := q.Account()
+	if _, builtin := q.BuiltinAccount(); sql != accountSQL(accountsTable, nil, false) || n != builtinAccountParams || !builtin {
+		t.Fatalf("Account() = %q, %d", sql, n)
+	}
+	sql, fields, columns := q.Event()
+	if want, _ := eventSQL(authEventFields[:authEventBaseFields]); sql != want || len(fields) != authEventBaseFields || len(columns) != authEventBaseFields {
+		t.Fatalf("Event() = %q, %v, %v", sql, fields, columns)
+	}
+	if q.validated {
+		t.Fatalf("built-in account query should be completed from the table columns")
+	}
+}
+
+func TestAccountSQL(t *testing.T) {
+	sql := accountSQL(accountsTable, []string{"clientid_match", "valid_until"}, false)
+	for _, want := range []string{
+		"SELECT password_hash, COALESCE(salt, '') AS salt, enabled, clientid, clientid_match, valid_until\n",
+		"FROM mqtt_accounts\nWHERE user_name=$1\n",
+		"ORDER BY (clientid = $2) IS TRUE DESC, (clientid IS NULL) DESC",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Fatalf("accountSQL = %q, want %q", sql, want)
+		}
+	}
+	if strings.Contains(sql, "*") {
+		t.Fatalf("accountSQL should list columns explicitly: %q", sql)
+	}
+}
+
+func TestAuthQuerySetCustomNeedsValidation(t *testing.T) {
+	var q authQuerySet
+	q.Reset()
+	q.SetEvent("INSERT INTO audit(ts) VALUES ($1)")
+	if q.validated {
+		t.Fatalf("custom query should require validation")
+	}
+	if sql, _, columns := q.Event(); sql != "INSERT INTO audit(ts) VALUES ($1)" || columns != nil {
+		t.Fatalf("Event() = %q, %v", sql, columns)
+	}
+}
+
+func TestEventSQL(t *testing.T) {
+	sql, fields := eventSQL([]string{"ts", "result", "reason", "client_id", "username", "peer", "protocol", "tenant_id"})
+	if !strings.Contains(sql, "(ts, result, reason, client_id, username, peer, protocol, tenant_id)") || !strings.Contains(sql, "VALUES ($1, $2, $3, $4, $5, $6, $7, $8)") {
+		t.Fatalf("eventSQL = %q", sql)
+	}
+	if want := []int{0, 1, 2, 3, 4, 5, 6, 8}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("fields = %v, want %v", fields, want)
+	}
+	args := eventArgs(authEvent{reason: "ok", superuser: true}, fields)
+	if len(args) != len(fields) || args[2] != "ok" {
+		t.Fatalf("eventArgs = %v", args)
+	}
+}
+
+func TestColumnString(t *testing.T) {
+	cases := []struct {
+		in   any
+		want string
+	}{
+		{"abc", "abc"},
+		{[]byte("xyz"), "xyz"},
+		{nil, ""},
+		{int32(1), ""},
+	}
+	for _, c := range cases {
+		if got := columnString(c.in); got != c.want {
+			t.Fatalf("columnString(%v) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestColumnBool(t *testing.T) {
+	cases := []struct {
+		in   any
+		def  bool
+		want bool
+	}{
+		{true, false, true},
+		{false, true, false},
+		{int16(0), true, false},
+		{int16(1), false, true},
+		{int32(2), false, true},
+		{int64(0), true, false},
+		{nil, true, true},
+		{"1", false, false},
+	}
+	for _, c := range cases {
+		if got := columnBool(c.in, c.def); got != c.want {
+			t.Fatalf("columnBool(%v, %v) = %v, want %v", c.in, c.def, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+var (
+	// rehashInflight 记录正在重新哈希的用户名，避免重连风暴时对同一账号重复计算和写库。
+	rehashInflight sync.Map
+	// rehashWG 跟踪后台重新哈希协程，cleanup 时等待其结束后再关闭连接池。
+	rehashWG sync.WaitGroup
+)
+
+// needsRehash 判断已存储的哈希是否需要升级到首选算法。
+func needsRehash(encoded string) bool {
+	return pluginutil.HashAlgorithm(encoded) != passwordHashAlgo
+}
+
+// scheduleRehash 异步用首选算法重新计算并回写密码哈希；返回 false 表示同一账号已有任务在执行。
+func scheduleRehash(username, password, oldHash string) bool {
+	if _, loaded := rehashInflight.LoadOrStore(username, struct{}{}); loaded {
+		return false
+	}
+	rehashWG.Add(1)
+	go func() {
+		defer rehashWG.Done()
+		defer rehashInflight.Delete(username)
+		if err := rehashPassword(username, password, oldHash); err != nil {
+			log(mosqLogWarning, "auth-plugin: rehash password failed", map[string]any{"username": username, "error": err.Error()})
+		}
+	}()
+	return true
+}
+
+// rehashPassword 计算新哈希并按旧值条件更新，防止覆盖期间被修改过的密码。
+func rehashPassword(username, password, oldHash string) error {
+	algo := passwordHashAlgo
+	encoded, err := pluginutil.HashPassword(algo, password)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	cancel := func() {}
+	// 保留 timeout<=0 时“无超时”的旧行为。
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	defer cancel()
+
+	p, err := poolHolder.Ensure(ctx, pluginutil.PGPrimary)
+	if err != nil {
+		return err
+	}
+	tenant, name, _ := splitTenant(username)
+	query, extra := tenantRehashSQL(tenant)
+	tag, err := p.Exec(ctx, query, append([]any{encoded, name, oldHash}, extra...)...)
+	poolHolder.Report(p, err)
+	if err != nil {
+		return err
+	}
+	log(mosqLogInfo, "auth-plugin: password rehashed", map[string]any{
+		"username": username,
+		"from":     pluginutil.HashAlgorithm(oldHash),
+		"to":       algo,
+		"updated":  tag.RowsAffected(),
+	})
+	return nil
+}
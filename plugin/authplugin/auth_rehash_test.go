@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func TestNeedsRehash(t *testing.T) {
+	old := passwordHashAlgo
+	t.Cleanup(func() { passwordHashAlgo = old })
+	passwordHashAlgo = pluginutil.HashAlgoBcrypt
+
+	tests := []struct {
+		encoded string
+		want    bool
+	}{
+		{encoded: "7a37b85c8918eac19a9089c0fa5a2ab4dce3f90528dcdeec108b23ddf3607b99", want: true},
+		{encoded: "$sha256$salt$abcd", want: true},
+		{encoded: "$2b$10$abcdefghijklmnopqrstuu", want: false},
+	}
+	for _, tc := range tests {
+		if got := needsRehash(tc.encoded); got != tc.want {
+			t.Fatalf("needsRehash(%q) = %v, want %v", tc.encoded, got, tc.want)
+		}
+	}
+}
+
+func TestScheduleRehashSkipsInflight(t *testing.T) {
+	rehashInflight.Store("alice", struct{}{})
+	t.Cleanup(func() { rehashInflight.Delete("alice") })
+
+	if scheduleRehash("alice", "pwd", "old") {
+		t.Fatal("scheduleRehash should skip when a rehash is already in flight")
+	}
+}
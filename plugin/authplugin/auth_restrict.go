@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// normalizeProtocol 将 3.1 / 3.1.1 / 5.0（可带 MQTT/ 前缀，5 等同 5.0）转为 ProtocolString 的形式。
+func normalizeProtocol(v string) (string, bool) {
+	v = strings.TrimSpace(v)
+	if len(v) >= 5 && strings.EqualFold(v[:5], "mqtt/") {
+		v = v[5:]
+	}
+	switch v {
+	case "3.1":
+		return pluginutil.ProtocolString(3), true
+	case "3.1.1":
+		return pluginutil.ProtocolString(4), true
+	case "5", "5.0":
+		return pluginutil.ProtocolString(5), true
+	default:
+		return "", false
+	}
+}
+
+// parseProtocols 解析协议版本列表；空列表返回 nil（不限制）。
+func parseProtocols(items []string) ([]string, error) {
+	var out []string
+	for _, item := range items {
+		p, ok := normalizeProtocol(item)
+		if !ok {
+			return nil, fmt.Errorf("unknown protocol %q", item)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// parseListeners 解析监听器列表，条目为端口号或传输方式（tcp / websockets）；空列表返回 nil（不限制）。
+func parseListeners(items []string) ([]string, error) {
+	var out []string
+	for _, item := range items {
+		item = strings.ToLower(strings.TrimSpace(item))
+		switch item {
+		case pluginutil.TransportTCP, pluginutil.TransportWebsockets:
+		default:
+			port, err := strconv.Atoi(item)
+			if err != nil || port <= 0 || port > 65535 {
+				return nil, fmt.Errorf("invalid listener %q", item)
+			}
+			item = strconv.Itoa(port)
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+// splitList 按逗号拆分配置值并去掉空条目。
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// protocolAllowed 判断协议版本是否在允许列表内；nil 表示不限制，协议未知时在受限账户下拒绝。
+func protocolAllowed(allowed []string, protocol string) bool {
+	if allowed == nil {
+		return true
+	}
+	for _, p := range allowed {
+		if p == protocol && protocol != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// listenerAllowed 判断连接的监听端口或传输方式是否命中允许列表；nil 表示不限制。
+func listenerAllowed(allowed []string, info pluginutil.ClientInfo) bool {
+	if allowed == nil {
+		return true
+	}
+	port := ""
+	if info.ListenerPort > 0 {
+		port = strconv.Itoa(info.ListenerPort)
+	}
+	for _, l := range allowed {
+		if (info.Transport != "" && l == info.Transport) || (port != "" && l == port) {
+			return true
+		}
+	}
+	return false
+}
+
+// connRestrictionReason 检查协议版本与监听器限制，返回拒绝原因；空串表示放行。
+func connRestrictionReason(protocols, listeners []string, info pluginutil.ClientInfo) string {
+	if !protocolAllowed(protocols, info.Protocol) {
+		return authReasonProtocolNotAllowed
+	}
+	if !listenerAllowed(listeners, info) {
+		return authReasonListenerNotAllowed
+	}
+	return ""
+}
+
+// preAuthReason 在访问数据库之前检查 clientid / 用户名格式、租户格式与全局协议版本、监听器限制，返回拒绝原因。
+func preAuthReason(info pluginutil.ClientInfo) string {
+	if r := checkClientFormat(info); r != "" {
+		return r
+	}
+	if r := tenantReason(info.Username); r != "" {
+		return r
+	}
+	return connRestrictionReason(allowedProtocols, allowedListeners, info)
+}
+
+// columnProtocols / columnListeners 解析账户行的 allowed_protocols / allowed_listeners 列：
+// 支持 text[] 与逗号分隔的文本，NULL 或空列表返回 nil（不限制）。
+func columnProtocols(v any) ([]string, error) {
+	items, err := columnStrings(v)
+	if err != nil {
+		return nil, err
+	}
+	return parseProtocols(items)
+}
+
+func columnListeners(v any) ([]string, error) {
+	items, err := columnStrings(v)
+	if err != nil {
+		return nil, err
+	}
+	return parseListeners(items)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func TestParseProtocols(t *testing.T) {
+	got, err := parseProtocols(splitList(" 3.1, MQTT/3.1.1 ,5"))
+	if err != nil {
+		t.Fatalf("parseProtocols: %v", err)
+	}
+	if want := []string{"MQTT/3.1", "MQTT/3.1.1", "MQTT/5.0"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseProtocols = %v, want %v", got, want)
+	}
+	if got, err := parseProtocols(splitList("")); err != nil || got != nil {
+		t.Fatalf("empty list = %v, %v; want nil", got, err)
+	}
+	if _, err := parseProtocols([]string{"4"}); err == nil {
+		t.Fatal("unknown protocol should fail")
+	}
+}
+
+func TestParseListeners(t *testing.T) {
+	got, err := parseListeners(splitList("TCP, 08883,websockets"))
+	if err != nil {
+		t.Fatalf("parseListeners: %v", err)
+	}
+	if want := []string{"tcp", "8883", "websockets"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseListeners = %v, want %v", got, want)
+	}
+	for _, v := range []string{"ws", "0", "70000"} {
+		if _, err := parseListeners([]string{v}); err == nil {
+			t.Errorf("parseListeners(%q) should fail", v)
+		}
+	}
+}
+
+func TestConnRestrictionReason(t *testing.T) {
+	ws := pluginutil.ClientInfo{Protocol: "MQTT/3.1.1", ListenerPort: 9001, Transport: pluginutil.TransportWebsockets}
+	tcp := pluginutil.ClientInfo{Protocol: "MQTT/5.0", ListenerPort: 1883, Transport: pluginutil.TransportTCP}
+	cases := []struct {
+		name      string
+		protocols []string
+		listeners []string
+		info      pluginutil.ClientInfo
+		want      string
+	}{
+		{"unrestricted", nil, nil, ws, ""},
+		{"protocol denied", []string{"MQTT/5.0"}, nil, ws, authReasonProtocolNotAllowed},
+		{"protocol allowed", []string{"MQTT/5.0"}, nil, tcp, ""},
+		{"transport denied", nil, []string{"tcp"}, ws, authReasonListenerNotAllowed},
+		{"port allowed", nil, []string{"tcp", "9001"}, ws, ""},
+		{"port denied", nil, []string{"8883"}, tcp, authReasonListenerNotAllowed},
+		{"unparsable config denies", nil, []string{}, tcp, authReasonListenerNotAllowed},
+		{"unknown protocol denied", []string{"MQTT/5.0"}, nil, pluginutil.ClientInfo{}, authReasonProtocolNotAllowed},
+	}
+	for _, tc := range cases {
+		if got := connRestrictionReason(tc.protocols, tc.listeners, tc.info); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestColumnListeners(t *testing.T) {
+	got, err := columnListeners([]any{"tcp", "9001"})
+	if err != nil || !reflect.DeepEqual(got, []string{"tcp", "9001"}) {
+		t.Fatalf("columnListeners(text[]) = %v, %v", got, err)
+	}
+	if got, err := columnListeners(nil); err != nil || got != nil {
+		t.Fatalf("columnListeners(NULL) = %v, %v; want nil", got, err)
+	}
+	if _, err := columnProtocols("5.0,mqtt-sn"); err == nil {
+		t.Fatal("unknown protocol in column should fail")
+	}
+}
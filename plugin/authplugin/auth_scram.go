@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// scramExchangeTTL 为 AUTH_START 到 AUTH_CONTINUE 之间允许的最长间隔，超时的交换在 TICK 中清理。
+const scramExchangeTTL = 60 * time.Second
+
+// scramExchange 保存一次进行中的 SCRAM 交换。
+type scramExchange struct {
+	server  *pluginutil.SCRAMServer
+	info    pluginutil.ClientInfo
+	attrs   accountAttrs
+	started time.Time
+	// pending 为 AUTH_START 时已确定的拒绝原因（账户不存在/禁用等），
+	// 延迟到最终步骤再返回，避免通过交换流程探测账户是否存在。
+	pending string
+}
+
+// scramTracker 以客户端指针地址为键保存进行中的交换，线程安全。
+type scramTracker struct {
+	mu        sync.Mutex
+	exchanges map[uintptr]*scramExchange
+}
+
+func newSCRAMTracker() *scramTracker {
+	return &scramTracker{exchanges: map[uintptr]*scramExchange{}}
+}
+
+// Put 登记交换，覆盖同一连接上未完成的旧交换。
+func (t *scramTracker) Put(key uintptr, ex *scramExchange) {
+	t.mu.Lock()
+	t.exchanges[key] = ex
+	t.mu.Unlock()
+}
+
+// Take 取出并移除交换；每次交换只允许完成一次。
+func (t *scramTracker) Take(key uintptr) (*scramExchange, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ex, ok := t.exchanges[key]
+	if ok {
+		delete(t.exchanges, key)
+	}
+	return ex, ok
+}
+
+// Forget 移除交换。
+func (t *scramTracker) Forget(key uintptr) {
+	t.mu.Lock()
+	delete(t.exchanges, key)
+	t.mu.Unlock()
+}
+
+// Prune 清理超时未完成的交换，返回清理数量。
+func (t *scramTracker) Prune(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for key, ex := range t.exchanges {
+		if now.Sub(ex.started) > scramExchangeTTL {
+			delete(t.exchanges, key)
+			n++
+		}
+	}
+	return n
+}
+
+// Reset 清空全部交换，插件重载时调用。
+func (t *scramTracker) Reset() {
+	t.mu.Lock()
+	t.exchanges = map[uintptr]*scramExchange{}
+	t.mu.Unlock()
+}
+
+// scramDecoySecret 用于为不存在或不可用的账户生成稳定的伪盐，使其交换过程与真实账户不可区分。
+var scramDecoySecret = func() []byte {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return b
+}()
+
+// scramDecoyVerifier 返回随机密钥的验证器；同一用户名在进程内得到相同的盐，最终证明必然失败。
+func scramDecoyVerifier(username string) pluginutil.SCRAMVerifier {
+	m := hmac.New(sha256.New, scramDecoySecret)
+	m.Write([]byte(username))
+	sum := m.Sum(nil)
+	key := make([]byte, sha256.Size)
+	_, _ = rand.Read(key)
+	return pluginutil.SCRAMVerifier{
+		Iterations: pluginutil.SCRAMDefaultIterations,
+		Salt:       sum[:16],
+		StoredKey:  key,
+		ServerKey:  key,
+	}
+}
+
+// scramStartResult 为 AUTH_START 的处理结果；out 为需要回送给客户端的认证数据。
+type scramStartResult struct {
+	code int
+	out  []byte
+}
+
+// runSCRAMStart 处理 client-first-message：查账户并回送 server-first-message。
+// info.Username 为 CONNECT 中的用户名，可为空；非空时必须与 SCRAM 用户名一致。
+func runSCRAMStart(session uintptr, info pluginutil.ClientInfo, data []byte) scramStartResult {
+	first, err := pluginutil.ParseSCRAMClientFirst(data)
+	if err != nil {
+		recordAuthResult(info, false, authReasonSCRAMMalformed)
+		return scramStartResult{code: mosqErrAuth}
+	}
+	if info.Username != "" && info.Username != first.Username {
+		recordAuthResult(info, false, authReasonSCRAMMalformed)
+		return scramStartResult{code: mosqErrAuth}
+	}
+	info.Username = first.Username
+	// 与 BASIC_AUTH 一致：命中 defer_rules 的账号交给其它插件。
+	if shouldDefer(info) {
+		return scramStartResult{code: mosqErrDefer}
+	}
+	if r := preAuthReason(info); r != "" {
+		recordAuthResult(info, false, r)
+		return scramStartResult{code: mosqErrAuth}
+	}
+
+	now := time.Now()
+	if checkLockout(info, now) {
+		recordAuthResult(info, false, authReasonLockedOut)
+		return scramStartResult{code: mosqErrAuth}
+	}
+
+	acct, found, err := lookupAccount(info.Username, info.ClientID)
+	if err != nil {
+		// 无法生成合法的服务端签名，fail_open 不适用于增强认证。
+		log(mosqLogWarning, "auth-plugin auth error", map[string]any{"error": err.Error(), "method": pluginutil.SCRAMSHA256})
+		recordAuthResult(info, false, authReasonDBError)
+		return scramStartResult{code: mosqErrAuth}
+	}
+
+	ex := &scramExchange{info: info, attrs: acct.accountAttrs, started: now}
+	verifier := scramDecoyVerifier(info.Username)
+	switch {
+	case !found:
+		ex.pending = authReasonUserNotFound
+	case !acct.enabled:
+		ex.pending = authReasonUserDisabled
+	case !clientIDBound(acct, info.ClientID, enforceBind):
+		ex.pending = authReasonClientIDMismatch
+	case acct.scramVerifier == "":
+		ex.pending = authReasonSCRAMNotConfigured
+	default:
+		v, err := pluginutil.ParseSCRAMVerifier(acct.scramVerifier)
+		if err != nil {
+			log(mosqLogWarning, "auth-plugin: invalid scram_verifier", map[string]any{"username": info.Username, "error": err.Error()})
+			ex.pending = authReasonSCRAMNotConfigured
+		} else {
+			verifier = v
+		}
+	}
+
+	server, out, err := pluginutil.NewSCRAMServer(first, verifier)
+	if err != nil {
+		log(mosqLogWarning, "auth-plugin: scram start failed", map[string]any{"error": err.Error()})
+		recordAuthResult(info, false, authReasonSCRAMMalformed)
+		return scramStartResult{code: mosqErrAuth}
+	}
+	ex.server = server
+	scramExchanges.Put(session, ex)
+	return scramStartResult{code: mosqErrAuthContinue, out: out}
+}
+
+// scramFinalResult 为 AUTH_CONTINUE 的处理结果；username 为认证通过的账户名。
+type scramFinalResult struct {
+	code     int
+	out      []byte
+	username string
+}
+
+// runSCRAMContinue 校验 client-final-message，成功时回送 server-final-message。
+func runSCRAMContinue(session uintptr, data []byte) scramFinalResult {
+	ex, ok := scramExchanges.Take(session)
+	if !ok {
+		return scramFinalResult{code: mosqErrAuth}
+	}
+	info := ex.info
+	now := time.Now()
+
+	out, err := ex.server.Final(data)
+	reason := authReasonOK
+	switch {
+	case ex.pending != "":
+		reason = ex.pending
+	case errors.Is(err, pluginutil.ErrSCRAMInvalidProof):
+		reason = authReasonInvalidPassword
+	case err != nil:
+		reason = authReasonSCRAMMalformed
+	default:
+		if r := checkAccountAttrs(ex.attrs, info, now); r != "" {
+			reason = r
+		} else if r := admitConnection(session, info, ex.attrs); r != "" {
+			reason = r
+		}
+	}
+	allow := reason == authReasonOK
+	observeAuthResult(info, allow, reason, now)
+	recordAuthOutcome(info, allow, reason, ex.attrs.acl.superuser)
+	if !allow {
+		return scramFinalResult{code: mosqErrAuth}
+	}
+	if session != 0 {
+		// 超级用户登记连接级 ACL 以跳过规则检查，其余账户清除旧记录。
+		connACLs.Put(session, connACL{superuser: ex.attrs.acl.superuser})
+		authSessions.Track(session, authSession{clientID: info.ClientID, username: info.Username, validUntil: ex.attrs.validUntil})
+	}
+	return scramFinalResult{code: mosqErrSuccess, out: out, username: info.Username}
+}
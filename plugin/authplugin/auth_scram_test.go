@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func TestSCRAMTrackerTakeOnce(t *testing.T) {
+	tr := newSCRAMTracker()
+	tr.Put(1, &scramExchange{started: time.Now()})
+	if _, ok := tr.Take(1); !ok {
+		t.Fatalf("exchange should be present")
+	}
+	if _, ok := tr.Take(1); ok {
+		t.Fatalf("exchange should only be taken once")
+	}
+}
+
+func TestSCRAMTrackerPrune(t *testing.T) {
+	tr := newSCRAMTracker()
+	now := time.Now()
+	tr.Put(1, &scramExchange{started: now.Add(-2 * scramExchangeTTL)})
+	tr.Put(2, &scramExchange{started: now})
+	if n := tr.Prune(now); n != 1 {
+		t.Fatalf("Prune removed %d, want 1", n)
+	}
+	if _, ok := tr.Take(2); !ok {
+		t.Fatalf("fresh exchange should survive prune")
+	}
+}
+
+func TestSCRAMDecoyVerifierStableSalt(t *testing.T) {
+	a := scramDecoyVerifier("ghost")
+	b := scramDecoyVerifier("ghost")
+	if !bytes.Equal(a.Salt, b.Salt) {
+		t.Fatalf("decoy salt should be stable per username")
+	}
+	if bytes.Equal(a.Salt, scramDecoyVerifier("other").Salt) {
+		t.Fatalf("decoy salt should differ between usernames")
+	}
+	if a.Iterations != pluginutil.SCRAMDefaultIterations {
+		t.Fatalf("decoy iterations = %d", a.Iterations)
+	}
+}
+
+func TestRunSCRAMStartDefersReservedUsers(t *testing.T) {
+	res := runSCRAMStart(0, pluginutil.ClientInfo{ClientID: "c1"}, []byte("n,,n=_ops,r=abc"))
+	if res.code != mosqErrDefer {
+		t.Fatalf("code = %d, want defer", res.code)
+	}
+}
+
+func TestRunSCRAMContinueWithoutStart(t *testing.T) {
+	scramExchanges.Reset()
+	if res := runSCRAMContinue(42, []byte("c=biws,r=x,p=y")); res.code != mosqErrAuth {
+		t.Fatalf("code = %d, want auth error", res.code)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// sessionSweepInterval 限制 TICK 回调中扫描到期会话的频率。
+const sessionSweepInterval = time.Second
+
+// authSession 记录已认证连接中需要到期断开的会话。
+type authSession struct {
+	clientID   string
+	username   string
+	validUntil time.Time
+}
+
+// sessionTracker 以客户端指针地址为键跟踪会话，DISCONNECT 时移除，线程安全。
+type sessionTracker struct {
+	mu        sync.Mutex
+	sessions  map[uintptr]authSession
+	lastSweep time.Time
+}
+
+func newSessionTracker() *sessionTracker {
+	return &sessionTracker{sessions: map[uintptr]authSession{}}
+}
+
+// Track 登记会话；validUntil 为零值时仅清除旧记录（同一指针可能被新连接复用）。
+func (t *sessionTracker) Track(key uintptr, s authSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s.validUntil.IsZero() {
+		delete(t.sessions, key)
+		return
+	}
+	t.sessions[key] = s
+}
+
+// Forget 移除会话。
+func (t *sessionTracker) Forget(key uintptr) {
+	t.mu.Lock()
+	delete(t.sessions, key)
+	t.mu.Unlock()
+}
+
+// Expired 取出并移除已到期的会话；距上次扫描不足 sessionSweepInterval 时返回 nil。
+func (t *sessionTracker) Expired(now time.Time) []authSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.lastSweep) < sessionSweepInterval {
+		return nil
+	}
+	t.lastSweep = now
+	var out []authSession
+	for key, s := range t.sessions {
+		if !now.Before(s.validUntil) {
+			out = append(out, s)
+			delete(t.sessions, key)
+		}
+	}
+	return out
+}
+
+// Len 返回当前跟踪的会话数。
+func (t *sessionTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.sessions)
+}
+
+// Reset 清空全部会话，插件重载时调用。
+func (t *sessionTracker) Reset() {
+	t.mu.Lock()
+	t.sessions = map[uintptr]authSession{}
+	t.lastSweep = time.Time{}
+	t.mu.Unlock()
+}
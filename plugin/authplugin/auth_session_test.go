@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionTrackerExpired(t *testing.T) {
+	tr := newSessionTracker()
+	now := time.Now()
+	tr.Track(1, authSession{clientID: "c1", validUntil: now.Add(time.Minute)})
+	tr.Track(2, authSession{clientID: "c2", validUntil: now.Add(time.Hour)})
+	tr.Track(3, authSession{clientID: "c3"})
+	if tr.Len() != 2 {
+		t.Fatalf("sessions without valid_until should not be tracked, len=%d", tr.Len())
+	}
+
+	if got := tr.Expired(now); len(got) != 0 {
+		t.Fatalf("nothing should expire yet: %+v", got)
+	}
+	got := tr.Expired(now.Add(2 * time.Minute))
+	if len(got) != 1 || got[0].clientID != "c1" {
+		t.Fatalf("expired sessions mismatch: %+v", got)
+	}
+	if tr.Len() != 1 {
+		t.Fatalf("expired session should be removed, len=%d", tr.Len())
+	}
+	// 扫描间隔内不重复扫描。
+	swept := now.Add(2 * time.Minute)
+	tr.Track(4, authSession{clientID: "c4", validUntil: swept})
+	if got := tr.Expired(swept.Add(sessionSweepInterval / 2)); got != nil {
+		t.Fatalf("sweep should be throttled: %+v", got)
+	}
+	if got := tr.Expired(swept.Add(sessionSweepInterval)); len(got) != 1 || got[0].clientID != "c4" {
+		t.Fatalf("sweep after interval mismatch: %+v", got)
+	}
+}
+
+func TestSessionTrackerForgetAndReuse(t *testing.T) {
+	tr := newSessionTracker()
+	now := time.Now()
+	tr.Track(1, authSession{clientID: "c1", validUntil: now.Add(time.Minute)})
+	tr.Forget(1)
+	if tr.Len() != 0 {
+		t.Fatalf("Forget should remove session")
+	}
+	tr.Track(1, authSession{clientID: "c1", validUntil: now.Add(time.Minute)})
+	// 同一指针被无期限账户的新连接复用时清除旧记录。
+	tr.Track(1, authSession{clientID: "c9"})
+	if tr.Len() != 0 {
+		t.Fatalf("reused key without valid_until should clear session")
+	}
+}
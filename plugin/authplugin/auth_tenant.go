@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+// tenant_mode 取值：账户表按 tenant_id 列区分租户，或每个租户使用同名 schema 下的 mqtt_accounts。
+const (
+	tenantModeColumn = "column"
+	tenantModeSchema = "schema"
+
+	// defaultTenantTopicPrefix 为租户连接可访问的主题前缀，%t 替换为租户名。
+	defaultTenantTopicPrefix = "%t/"
+	// tenantTopicPrefixNone 表示不限制租户的主题范围。
+	tenantTopicPrefixNone = "none"
+
+	// pgErrUndefinedTable 为表不存在的 SQLSTATE。
+	pgErrUndefinedTable = "42P01"
+)
+
+// tenantNamePattern 限制租户名字符，租户名会出现在主题前缀与 schema 名中。
+var tenantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tenantConfig 为多租户配置；separator 为空表示未启用。
+type tenantConfig struct {
+	separator string
+	mode      string
+	// topicPrefix 为空表示不限制主题。
+	topicPrefix string
+}
+
+func defaultTenantConfig() tenantConfig {
+	return tenantConfig{mode: tenantModeColumn, topicPrefix: defaultTenantTopicPrefix}
+}
+
+// updateTenantPasswordHashSQL 为 column 模式下的重新哈希回写，限定在同一租户内。
+const updateTenantPasswordHashSQL = `
+UPDATE mqtt_accounts
+SET password_hash=$1, salt=''
+WHERE user_name=$2 AND password_hash=$3 AND tenant_id IS NOT DISTINCT FROM $4
+`
+
+// parseTenantMode 解析 tenant_mode。
+func parseTenantMode(v string) (string, bool) {
+	switch m := strings.ToLower(strings.TrimSpace(v)); m {
+	case tenantModeColumn, tenantModeSchema:
+		return m, true
+	default:
+		return "", false
+	}
+}
+
+// parseTenantTopicPrefix 解析 tenant_topic_prefix：必须包含 %t、以 / 结尾且不含通配符；none 表示不限制。
+// 以 / 结尾保证按完整主题层级匹配，租户 a 不会命中租户 ab 的主题。
+func parseTenantTopicPrefix(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if strings.EqualFold(v, tenantTopicPrefixNone) {
+		return "", nil
+	}
+	if !strings.Contains(v, "%t") {
+		return "", fmt.Errorf("tenant_topic_prefix %q must contain %%t", v)
+	}
+	if strings.ContainsAny(v, "+#") {
+		return "", fmt.Errorf("tenant_topic_prefix %q must not contain wildcards", v)
+	}
+	if !strings.HasSuffix(v, "/") {
+		return "", fmt.Errorf("tenant_topic_prefix %q must end with /", v)
+	}
+	return v, nil
+}
+
+// splitTenant 按 tenant_separator 拆分用户名（第一个分隔符之前为租户）。
+// 未启用多租户或用户名不含分隔符时 tenant 为空、name 为原用户名；ok=false 表示租户名或账户名不合法。
+func splitTenant(username string) (tenant, name string, ok bool) {
+	sep := tenantCfg.separator
+	if sep == "" {
+		return "", username, true
+	}
+	tenant, name, found := strings.Cut(username, sep)
+	if !found {
+		return "", username, true
+	}
+	if !tenantNamePattern.MatchString(tenant) || name == "" {
+		return "", "", false
+	}
+	return tenant, name, true
+}
+
+// tenantOf 返回用户名中的租户；无租户或格式不合法时为空。
+func tenantOf(username string) string {
+	tenant, _, _ := splitTenant(username)
+	return tenant
+}
+
+// tenantReason 在访问数据库之前检查用户名中的租户格式。
+func tenantReason(username string) string {
+	if _, _, ok := splitTenant(username); !ok {
+		return authReasonInvalidTenant
+	}
+	return ""
+}
+
+// tenantColumnMode 报告是否启用了 column 模式的多租户。
+func tenantColumnMode() bool {
+	return tenantCfg.separator != "" && tenantCfg.mode == tenantModeColumn
+}
+
+// tenantAccountQuery 返回账户查询与参数个数。自定义 auth_query 原样使用（$3 为租户）；
+// 内置 SQL 以相同的列清单按 tenant_mode 限定在租户范围内：column 模式增加 tenant_id 条件（无租户匹配 NULL），
+// schema 模式改查租户 schema 下的表。
+func tenantAccountQuery(tenant string) (string, int) {
+	query, n := authQueries.Account()
+	optional, builtin := authQueries.BuiltinAccount()
+	if tenantCfg.separator == "" || !builtin {
+		return query, n
+	}
+	if tenantCfg.mode == tenantModeSchema {
+		if tenant == "" {
+			return query, n
+		}
+		return accountSQL(tenantAccountsTable(tenant), optional, false), n
+	}
+	return accountSQL(accountsTable, optional, true), authQueryMaxParams
+}
+
+// tenantACLQuery 返回 ACL 规则查询与参数，按 tenant_mode 限定在连接所属租户范围内：
+// column 模式只读取 tenant_id 与连接租户相同的规则（无租户的连接只读取 tenant_id 为 NULL 的规则），
+// schema 模式改查租户 schema 下的 mqtt_acls；通配行（user_name / clientid 为 NULL）因此也只作用于本租户。
+func tenantACLQuery(info pluginutil.ClientInfo) (string, []any) {
+	args := []any{info.Username, info.ClientID}
+	switch {
+	case tenantCfg.separator == "":
+		return aclRulesSQL(aclsTable, false), args
+	case tenantCfg.mode == tenantModeSchema:
+		tenant := tenantOf(info.Username)
+		if tenant == "" {
+			return aclRulesSQL(aclsTable, false), args
+		}
+		return aclRulesSQL(pgx.Identifier{tenant, aclsTable}.Sanitize(), false), args
+	default:
+		return aclRulesSQL(aclsTable, true), append(args, pluginutil.OptionalString(tenantOf(info.Username)))
+	}
+}
+
+// tenantTableMissing 判断查询错误是否因 schema 模式下租户 schema 或账户表不存在（42P01 undefined_table），
+// 此时按账户不存在处理，避免未知租户刷出数据库错误日志。
+func tenantTableMissing(tenant string, err error) bool {
+	if tenant == "" || tenantCfg.separator == "" || tenantCfg.mode != tenantModeSchema {
+		return false
+	}
+	if _, builtin := authQueries.BuiltinAccount(); !builtin {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgErrUndefinedTable
+}
+
+// tenantRehashSQL 返回重新哈希回写 SQL 及租户之外的额外参数。
+func tenantRehashSQL(tenant string) (string, []any) {
+	switch {
+	case tenantCfg.separator == "":
+		return updatePasswordHashSQL, nil
+	case tenantCfg.mode == tenantModeSchema:
+		if tenant == "" {
+			return updatePasswordHashSQL, nil
+		}
+		return strings.Replace(updatePasswordHashSQL, "UPDATE mqtt_accounts", "UPDATE "+tenantAccountsTable(tenant), 1), nil
+	default:
+		return updateTenantPasswordHashSQL, []any{pluginutil.OptionalString(tenant)}
+	}
+}
+
+// tenantAccountsTable 返回租户 schema 下账户表的限定名。
+func tenantAccountsTable(tenant string) string {
+	return pgx.Identifier{tenant, accountsTable}.Sanitize()
+}
+
+// tenantTopicAllowed 判断租户连接是否只访问本租户的主题前缀；无租户的连接或未配置前缀时不限制。
+// 订阅时 topic 为过滤器，以通配符开头（如 #）的订阅同样被拒绝；租户格式不合法的用户名一律拒绝。
+func tenantTopicAllowed(username, topic string) bool {
+	if tenantCfg.topicPrefix == "" {
+		return true
+	}
+	tenant, _, ok := splitTenant(username)
+	if !ok {
+		return false
+	}
+	if tenant == "" {
+		return true
+	}
+	return strings.HasPrefix(topic, strings.ReplaceAll(tenantCfg.topicPrefix, "%t", tenant))
+}
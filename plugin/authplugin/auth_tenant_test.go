@@ -0,0 +1,200 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"mosquitto-plugin/internal/pluginutil"
+)
+
+func withTenantConfig(t *testing.T, cfg tenantConfig) {
+	t.Helper()
+	prev := tenantCfg
+	tenantCfg = cfg
+	t.Cleanup(func() { tenantCfg = prev })
+}
+
+func TestSplitTenant(t *testing.T) {
+	if tenant, name, ok := splitTenant("acme:dev1"); tenant != "" || name != "acme:dev1" || !ok {
+		t.Fatalf("disabled tenancy = %q, %q, %v", tenant, name, ok)
+	}
+	cfg := defaultTenantConfig()
+	cfg.separator = ":"
+	withTenantConfig(t, cfg)
+
+	cases := []struct {
+		username, tenant, name string
+		ok                     bool
+	}{
+		{"acme:dev1", "acme", "dev1", true},
+		{"acme:dev:1", "acme", "dev:1", true},
+		{"dev1", "", "dev1", true},
+		{":dev1", "", "", false},
+		{"acme:", "", "", false},
+		{"ac/me:dev1", "", "", false},
+	}
+	for _, tc := range cases {
+		tenant, name, ok := splitTenant(tc.username)
+		if tenant != tc.tenant || name != tc.name || ok != tc.ok {
+			t.Errorf("splitTenant(%q) = %q, %q, %v", tc.username, tenant, name, ok)
+		}
+	}
+	if got := tenantReason("acme:"); got != authReasonInvalidTenant {
+		t.Fatalf("tenantReason = %q", got)
+	}
+}
+
+func TestParseTenantTopicPrefix(t *testing.T) {
+	if got, err := parseTenantTopicPrefix(" tenants/%t/ "); err != nil || got != "tenants/%t/" {
+		t.Fatalf("parseTenantTopicPrefix = %q, %v", got, err)
+	}
+	if got, err := parseTenantTopicPrefix("None"); err != nil || got != "" {
+		t.Fatalf("none = %q, %v", got, err)
+	}
+	for _, v := range []string{"tenants/", "%t/+/", "tenants/%t"} {
+		if _, err := parseTenantTopicPrefix(v); err == nil {
+			t.Errorf("parseTenantTopicPrefix(%q) should fail", v)
+		}
+	}
+}
+
+func TestTenantAccountQuery(t *testing.T) {
+	authQueries.Reset()
+	defer authQueries.Reset()
+	authQueries.accountOptional = []string{"clientid_match"}
+	cfg := defaultTenantConfig()
+	cfg.separator = ":"
+	withTenantConfig(t, cfg)
+
+	if q, n := tenantAccountQuery("acme"); q != accountSQL(accountsTable, []string{"clientid_match"}, true) || n != 3 {
+		t.Fatalf("column mode = %q, %d", q, n)
+	}
+	if q, _ := tenantAccountQuery("acme"); !strings.Contains(q, "WHERE user_name=$1 AND tenant_id IS NOT DISTINCT FROM $3\nORDER BY (clientid = $2) IS TRUE DESC") {
+		t.Fatalf("column mode should share the built-in query: %q", q)
+	}
+	if q, extra := tenantRehashSQL("acme"); q != updateTenantPasswordHashSQL || !reflect.DeepEqual(extra, []any{"acme"}) {
+		t.Fatalf("column mode rehash = %q, %v", q, extra)
+	}
+
+	tenantCfg.mode = tenantModeSchema
+	if q, n := tenantAccountQuery("acme"); q != accountSQL(`"acme"."mqtt_accounts"`, []string{"clientid_match"}, false) || n != builtinAccountParams {
+		t.Fatalf("schema mode = %q, %d", q, n)
+	}
+	if q, _ := tenantAccountQuery(""); q != accountSQL(accountsTable, nil, false) {
+		t.Fatalf("schema mode without tenant = %q", q)
+	}
+	missing := &pgconn.PgError{Code: pgErrUndefinedTable}
+	if !tenantTableMissing("acme", missing) || tenantTableMissing("", missing) || tenantTableMissing("acme", &pgconn.PgError{Code: "42501"}) {
+		t.Fatal("only undefined_table for a tenant schema should count as not found")
+	}
+	if q, extra := tenantRehashSQL("acme"); !strings.Contains(q, `UPDATE "acme"."mqtt_accounts"`) || extra != nil {
+		t.Fatalf("schema mode rehash = %q, %v", q, extra)
+	}
+
+	// 自定义 auth_query 原样使用，$3 为租户。
+	authQueries.SetAccount("SELECT password_hash FROM accounts WHERE tenant=$3 AND name=$1")
+	if q, _ := tenantAccountQuery("acme"); !strings.Contains(q, "tenant=$3") {
+		t.Fatalf("custom query should not be rewritten: %q", q)
+	}
+	if tenantTableMissing("acme", missing) {
+		t.Fatal("custom query errors should not be mapped to not found")
+	}
+}
+
+func TestBuiltinAccountColumnsTenant(t *testing.T) {
+	present := map[string]bool{"password_hash": true, "clientid_match": true}
+	if optional, err := builtinAccountColumns(present); err != nil || !reflect.DeepEqual(optional, []string{"clientid_match"}) {
+		t.Fatalf("without tenancy = %v, %v", optional, err)
+	}
+	cfg := defaultTenantConfig()
+	cfg.separator = ":"
+	withTenantConfig(t, cfg)
+	if _, err := builtinAccountColumns(present); err == nil || !strings.Contains(err.Error(), "tenant_id") {
+		t.Fatalf("column mode without tenant_id should fail init: %v", err)
+	}
+	present["tenant_id"] = true
+	if _, err := builtinAccountColumns(present); err != nil {
+		t.Fatalf("column mode with tenant_id: %v", err)
+	}
+	tenantCfg.mode = tenantModeSchema
+	delete(present, "tenant_id")
+	if _, err := builtinAccountColumns(present); err != nil {
+		t.Fatalf("schema mode does not need tenant_id: %v", err)
+	}
+}
+
+func TestTenantACLQuery(t *testing.T) {
+	info := pluginutil.ClientInfo{Username: "acme:dev1", ClientID: "c1"}
+	if q, args := tenantACLQuery(info); q != aclRulesSQL(aclsTable, false) || len(args) != 2 {
+		t.Fatalf("disabled tenancy = %q, %v", q, args)
+	}
+	cfg := defaultTenantConfig()
+	cfg.separator = ":"
+	withTenantConfig(t, cfg)
+	q, args := tenantACLQuery(info)
+	if !strings.Contains(q, "FROM mqtt_acls") || !strings.Contains(q, "tenant_id IS NOT DISTINCT FROM $3") || len(args) != 3 {
+		t.Fatalf("column mode = %q, %v", q, args)
+	}
+	// 无租户前缀的连接以 NULL 匹配，只命中 tenant_id 为 NULL 的规则。
+	if _, args := tenantACLQuery(pluginutil.ClientInfo{Username: "admin"}); len(args) != 3 || args[2] != nil {
+		t.Fatalf("column mode without tenant args = %v", args)
+	}
+
+	tenantCfg.mode = tenantModeSchema
+	if q, args := tenantACLQuery(info); !strings.Contains(q, `FROM "acme"."mqtt_acls"`) || strings.Contains(q, "$3") || len(args) != 2 {
+		t.Fatalf("schema mode = %q, %v", q, args)
+	}
+}
+
+func TestTenantTopicAllowed(t *testing.T) {
+	cfg := defaultTenantConfig()
+	cfg.separator = ":"
+	withTenantConfig(t, cfg)
+
+	cases := []struct {
+		username, topic string
+		want            bool
+	}{
+		{"acme:dev1", "acme/d/dev1/up", true},
+		{"acme:dev1", "globex/d/dev1/up", false},
+		{"acme:dev1", "acmecorp/d/dev1/up", false},
+		{"acme:dev1", "acme", false},
+		{"acme:dev1", "#", false},
+		{"acme:dev1", "+/d/dev1/up", false},
+		{"dev1", "any/topic", true},
+		{":dev1", "any/topic", false},
+	}
+	for _, tc := range cases {
+		if got := tenantTopicAllowed(tc.username, tc.topic); got != tc.want {
+			t.Errorf("tenantTopicAllowed(%q, %q) = %v, want %v", tc.username, tc.topic, got, tc.want)
+		}
+	}
+
+	tenantCfg.topicPrefix = ""
+	if !tenantTopicAllowed("acme:dev1", "globex/x") {
+		t.Fatal("empty prefix should not confine tenants")
+	}
+}
+
+func TestTenantACLPatternAndEvent(t *testing.T) {
+	cfg := defaultTenantConfig()
+	cfg.separator = ":"
+	withTenantConfig(t, cfg)
+
+	info := pluginutil.ClientInfo{Username: "acme:dev1", ClientID: "c1"}
+	if got, ok := expandACLPattern("%t/d/%c/up", info); !ok || got != "acme/d/c1/up" {
+		t.Fatalf("expandACLPattern = %q, %v", got, ok)
+	}
+	if _, ok := expandACLPattern("%t/d/%c/up", pluginutil.ClientInfo{Username: "dev1", ClientID: "c1"}); ok {
+		t.Fatal("tenant placeholder without tenant should not match")
+	}
+	if args := authEventArgs(authEvent{info: info}); args[8] != "acme" {
+		t.Fatalf("tenant_id arg = %v", args[8])
+	}
+	if args := authEventArgs(authEvent{info: pluginutil.ClientInfo{Username: "dev1"}}); args[8] != nil {
+		t.Fatalf("tenant_id arg without tenant = %v", args[8])
+	}
+}
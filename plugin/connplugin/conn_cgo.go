@@ -22,6 +22,8 @@ import (
 	"context"
 	"os"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
@@ -106,7 +108,7 @@ func onConnect(client *C.struct_mosquitto) {
 	}
 	activeConnections.MarkConnected(key)
 	if err := recordEvent(clientInfoFromClient(client), connEventTypeConnect, nil); err != nil {
-		log(mosqLogWarning, "conn-plugin: record connect event failed", map[string]any{"error": err.Error()})
+		logRecordError("conn-plugin: record connect event failed", err)
 	}
 }
 
@@ -126,7 +128,7 @@ func onDisconnect(client *C.struct_mosquitto, reasonCode int) {
 	// disconnect 才会携带 reason code；connect 场景传 nil。
 	reason := reasonCode
 	if err := recordEvent(clientInfoFromClient(client), connEventTypeDisconnect, &reason); err != nil {
-		log(mosqLogWarning, "conn-plugin: record disconnect event failed", map[string]any{"error": err.Error()})
+		logRecordError("conn-plugin: record disconnect event failed", err)
 	}
 }
 
@@ -165,6 +167,11 @@ func go_mosq_plugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
 
 	pid = id
 	pgDSN = ""
+	pgReplicaDSNs = nil
+	pgHealthCheckInterval = defaultPGHealthCheckInterval
+	pgBreakerThreshold = 0
+	pgBreakerOpen = defaultPGBreakerOpen
+	breakerSkipCounter.Store(0)
 	timeout = defaultTimeout
 	debugSkipCounter = 0
 	debugRecordCounter = 0
@@ -180,6 +187,29 @@ func go_mosq_plugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
 		switch key {
 		case "conn_pg_dsn":
 			pgDSN = value
+		case "conn_pg_replica_dsn":
+			// 可重复配置，按出现顺序排在 conn_pg_dsn 之后。
+			if dsn := strings.TrimSpace(value); dsn != "" {
+				pgReplicaDSNs = append(pgReplicaDSNs, dsn)
+			}
+		case "conn_pg_health_check_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				pgHealthCheckInterval = dur
+			} else {
+				log(mosqLogWarning, "conn-plugin: invalid conn_pg_health_check_ms", map[string]any{"value": value, "pg_health_check_ms": int(pgHealthCheckInterval / time.Millisecond)})
+			}
+		case "conn_pg_breaker_threshold":
+			if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n >= 0 {
+				pgBreakerThreshold = n
+			} else {
+				log(mosqLogWarning, "conn-plugin: invalid conn_pg_breaker_threshold", map[string]any{"value": value, "pg_breaker_threshold": pgBreakerThreshold})
+			}
+		case "conn_pg_breaker_open_ms":
+			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
+				pgBreakerOpen = dur
+			} else {
+				log(mosqLogWarning, "conn-plugin: invalid conn_pg_breaker_open_ms", map[string]any{"value": value, "pg_breaker_open_ms": int(pgBreakerOpen / time.Millisecond)})
+			}
 		case "conn_timeout_ms":
 			if dur, ok := pluginutil.ParseTimeoutMS(value); ok {
 				timeout = dur
@@ -197,8 +227,14 @@ func go_mosq_plugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
 		log(mosqLogError, "conn-plugin: invalid pg_dsn", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN), "error": err.Error()})
 		return C.MOSQ_ERR_UNKNOWN
 	}
+	for _, dsn := range pgReplicaDSNs {
+		if _, err := pgxpool.ParseConfig(dsn); err != nil {
+			log(mosqLogError, "conn-plugin: invalid conn_pg_replica_dsn", map[string]any{"pg_dsn": pluginutil.SafeDSN(dsn), "error": err.Error()})
+			return C.MOSQ_ERR_UNKNOWN
+		}
+	}
 
-	log(mosqLogInfo, "conn-plugin: initializing", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN), "timeout_ms": int(timeout / time.Millisecond)})
+	log(mosqLogInfo, "conn-plugin: initializing", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN), "pg_replicas": len(pgReplicaDSNs), "pg_breaker_threshold": pgBreakerThreshold, "timeout_ms": int(timeout / time.Millisecond)})
 
 	ctx := context.Background()
 	cancel := func() {}
@@ -207,11 +243,17 @@ func go_mosq_plugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
 		ctx, cancel = context.WithTimeout(context.Background(), timeout)
 	}
 	defer cancel()
-	_, created, err := poolHolder.Ensure(ctx, pgDSN, connPGPoolOptions)
-	if err != nil {
+	poolHolder.Configure(append([]string{pgDSN}, pgReplicaDSNs...), connPGPoolOptions, logPGTarget)
+	if pgBreakerThreshold > 0 {
+		poolHolder.SetBreakers(pgBreakerThreshold, pgBreakerOpen, logPGBreaker)
+	}
+	if p, err := poolHolder.Ensure(ctx, pluginutil.PGPrimary); err != nil {
 		log(mosqLogWarning, "conn-plugin: initial pg connection failed", map[string]any{"error": err.Error()})
-	} else if created {
-		log(mosqLogInfo, "conn-plugin: postgres pool connected", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN)})
+	} else {
+		poolHolder.Report(p, nil)
+	}
+	if len(pgReplicaDSNs) > 0 {
+		poolHolder.StartHealthCheck(pgHealthCheckInterval, timeout)
 	}
 
 	if rc := C.register_event_callback(pid, C.MOSQ_EVT_CONNECT, C.mosq_event_cb(C.connect_cb_c)); rc != C.MOSQ_ERR_SUCCESS {
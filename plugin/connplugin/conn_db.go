@@ -2,11 +2,44 @@ package main
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"mosquitto-plugin/internal/pluginutil"
 )
 
+// logPGTarget 在写入目标切换时输出日志；连接事件只写主库，忽略副本的选择变化。
+func logPGTarget(role pluginutil.PGRole, dsn string) {
+	if role != pluginutil.PGPrimary {
+		return
+	}
+	if dsn == "" {
+		log(mosqLogWarning, "conn-plugin: no healthy postgres primary", nil)
+		return
+	}
+	log(mosqLogInfo, "conn-plugin: postgres target selected", map[string]any{"role": role.String(), "pg_dsn": pluginutil.SafeDSN(dsn)})
+}
+
+// logPGBreaker 输出熔断器状态变化；打开期间连接事件直接跳过写入。
+func logPGBreaker(dsn string, from, to pluginutil.BreakerState) {
+	level := mosqLogInfo
+	if to == pluginutil.BreakerOpen {
+		level = mosqLogWarning
+	}
+	log(level, "conn-plugin: postgres circuit breaker", map[string]any{"pg_dsn": pluginutil.SafeDSN(dsn), "from": from.String(), "to": to.String()})
+}
+
+// logRecordError 记录写库失败；熔断器打开时按采样输出，避免每个连接都刷一条 warning。
+func logRecordError(msg string, err error) {
+	if errors.Is(err, pluginutil.ErrBreakerOpen) {
+		if n := breakerSkipCounter.Add(1); n%int64(debugSampleEvery) == 0 {
+			log(mosqLogWarning, "conn-plugin: event skipped, circuit breaker open", map[string]any{"skipped": n})
+		}
+		return
+	}
+	log(mosqLogWarning, msg, map[string]any{"error": err.Error()})
+}
+
 func recordEvent(info pluginutil.ClientInfo, eventType string, reasonCode *int) error {
 	ctx := context.Background()
 	cancel := func() {}
@@ -16,13 +49,10 @@ func recordEvent(info pluginutil.ClientInfo, eventType string, reasonCode *int)
 	}
 	defer cancel()
 
-	p, created, err := poolHolder.Ensure(ctx, pgDSN, connPGPoolOptions)
+	p, err := poolHolder.Ensure(ctx, pluginutil.PGPrimary)
 	if err != nil {
 		return err
 	}
-	if created {
-		log(mosqLogInfo, "conn-plugin: postgres pool connected", map[string]any{"pg_dsn": pluginutil.SafeDSN(pgDSN)})
-	}
 
 	ts := time.Now().UTC()
 	connectTS, disconnectTS := any(nil), any(nil)
@@ -49,6 +79,7 @@ func recordEvent(info pluginutil.ClientInfo, eventType string, reasonCode *int)
 		connectTS,
 		disconnectTS,
 	)
+	poolHolder.Report(p, err)
 	if err != nil {
 		return err
 	}
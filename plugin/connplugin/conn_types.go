@@ -1,6 +1,7 @@
 package main
 
 import (
+	"sync/atomic"
 	"time"
 
 	"mosquitto-plugin/internal/pluginutil"
@@ -34,13 +35,17 @@ const (
 	connEventTypeConnect    = "connect"
 	connEventTypeDisconnect = "disconnect"
 
-	defaultTimeout   = 1000 * time.Millisecond
-	debugSampleEvery = uint64(128)
+	defaultTimeout = 1000 * time.Millisecond
+	// defaultPGHealthCheckInterval 为配置了备用节点时后台探测主库的间隔。
+	defaultPGHealthCheckInterval = 5 * time.Second
+	// defaultPGBreakerOpen 为熔断器打开后到放行探测请求前的等待时间。
+	defaultPGBreakerOpen = 10 * time.Second
+	debugSampleEvery     = uint64(128)
 )
 
 var (
 	// poolHolder 统一管理连接事件插件的 PostgreSQL 连接池。
-	poolHolder pluginutil.SharedPGPool
+	poolHolder pluginutil.PGCluster
 	// connPGPoolOptions 定义连接事件插件默认连接池参数。
 	connPGPoolOptions = pluginutil.PGPoolOptions{
 		MaxConns:          16,
@@ -48,11 +53,18 @@ var (
 		MaxConnIdleTime:   60 * time.Second,
 		HealthCheckPeriod: 30 * time.Second,
 	}
-	pgDSN      string
-	timeout    = defaultTimeout
+	pgDSN string
+	// pgReplicaDSNs 为 conn_pg_replica_dsn 配置的备用节点；连接事件只写主库，主库切换后写入提升后的节点。
+	pgReplicaDSNs         []string
+	pgHealthCheckInterval = defaultPGHealthCheckInterval
+	// pgBreakerThreshold 为连续多少次连接层错误后打开熔断器，0 表示不熔断。
+	pgBreakerThreshold int
+	pgBreakerOpen      = defaultPGBreakerOpen
+	timeout            = defaultTimeout
 
 	activeConnections = newConnTracker()
 
 	debugSkipCounter   uint64
 	debugRecordCounter uint64
+	breakerSkipCounter atomic.Int64
 )